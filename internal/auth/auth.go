@@ -8,6 +8,7 @@ import (
 type User struct {
 	Name     string
 	Password string
+	Admin    bool
 }
 
 func ValidateUsername(name string) error {
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -15,27 +17,38 @@ type Cluster interface {
 	Remove(string) error
 	IsLeader() bool
 	GetLeader() string
+	GetNodeID() string
+	Term() uint64
+	Replicate(key string, value string)
+	Replicated(key string) (string, bool)
 	Shutdown() error
 }
 
 type BullyCluster struct {
-	config  ClusterConfig
-	nodeID  string
-	peers   map[string]string // nodeID -> managerAddr
-	leader  string
-	isUp    bool
-	mu      sync.RWMutex
-	manager MembershipManager
-	stopCh  chan struct{}
-	wg      sync.WaitGroup
+	config      ClusterConfig
+	nodeID      string
+	peers       map[string]string // nodeID -> managerAddr
+	leader      string
+	term        uint64 // number of times the leader changed
+	isUp        bool
+	state       map[string]string // state received from the leader
+	pending     map[string]string // state waiting to be sent to the peers
+	replicateCh chan struct{}
+	mu          sync.RWMutex
+	manager     MembershipManager
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
 }
 
 func NewCluster(config ClusterConfig) (*BullyCluster, error) {
 	c := &BullyCluster{
-		config: config,
-		nodeID: config.Node,
-		peers:  make(map[string]string),
-		stopCh: make(chan struct{}),
+		config:      config,
+		nodeID:      config.Node,
+		peers:       make(map[string]string),
+		state:       make(map[string]string),
+		pending:     make(map[string]string),
+		replicateCh: make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
 	}
 
 	manager, err := GetManager(&config, c)
@@ -61,8 +74,9 @@ func (c *BullyCluster) Start() error {
 	c.isUp = true
 	c.mu.Unlock()
 
-	c.wg.Add(1)
+	c.wg.Add(2)
 	go c.heartbeatLoop()
+	go c.replicationLoop()
 
 	return nil
 }
@@ -118,6 +132,9 @@ func (c *BullyCluster) Remove(nodeID string) error {
 func (c *BullyCluster) SetLeader(nodeID string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.leader != nodeID {
+		c.term++
+	}
 	c.leader = nodeID
 	slog.Info("Leader set",
 		slog.String("leader", nodeID),
@@ -128,6 +145,9 @@ func (c *BullyCluster) SetLeader(nodeID string) {
 func (c *BullyCluster) Bootstrap() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.leader != c.nodeID {
+		c.term++
+	}
 	c.leader = c.nodeID
 	slog.Info("Node bootstrapped as leader",
 		slog.String("node_id", c.nodeID),
@@ -138,6 +158,14 @@ func (c *BullyCluster) GetNodeID() string {
 	return c.nodeID
 }
 
+// Term returns the number of times the leader changed, so the state
+// received from the leader is only checked again after a change.
+func (c *BullyCluster) Term() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.term
+}
+
 func (c *BullyCluster) GetPeers() map[string]string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -148,6 +176,92 @@ func (c *BullyCluster) GetPeers() map[string]string {
 	return result
 }
 
+// Replicate queues the value of a key to be sent to the peers, so the node
+// that becomes the next leader can continue from it. Only the latest value
+// of every key is sent, values are sent in the background and may be lost
+// if the leader fails before sending them.
+func (c *BullyCluster) Replicate(key string, value string) {
+	c.mu.Lock()
+	c.pending[key] = value
+	c.mu.Unlock()
+
+	select {
+	case c.replicateCh <- struct{}{}:
+	default:
+	}
+}
+
+// Replicated returns the last value of a key received from the leader.
+func (c *BullyCluster) Replicated(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	value, ok := c.state[key]
+	return value, ok
+}
+
+// StoreState keeps the values sent by the leader.
+func (c *BullyCluster) StoreState(state map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, value := range state {
+		c.state[key] = value
+	}
+}
+
+func (c *BullyCluster) replicationLoop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-c.replicateCh:
+			c.sendState()
+		}
+	}
+}
+
+// sendState sends the pending values to every peer.
+func (c *BullyCluster) sendState() {
+	c.mu.Lock()
+	state := c.pending
+	c.pending = make(map[string]string)
+	peers := make(map[string]string)
+	for id, addr := range c.peers {
+		peers[id] = addr
+	}
+	c.mu.Unlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	for id, addr := range peers {
+		if id == c.nodeID {
+			continue
+		}
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/state", addr), bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(c.config.User, c.config.Pass)
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Warn("Failed to replicate state to peer",
+				slog.String("peer", id),
+				slog.Any("error", err),
+			)
+		} else {
+			resp.Body.Close()
+		}
+	}
+}
+
 func (c *BullyCluster) heartbeatLoop() {
 	defer c.wg.Done()
 	ticker := time.NewTicker(2 * time.Second)
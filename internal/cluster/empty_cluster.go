@@ -27,6 +27,21 @@ func (c *EmptyCluster) GetLeader() string {
 	return ""
 }
 
+func (c *EmptyCluster) GetNodeID() string {
+	return ""
+}
+
+func (c *EmptyCluster) Term() uint64 {
+	return 0
+}
+
+func (c *EmptyCluster) Replicate(key string, value string) {
+}
+
+func (c *EmptyCluster) Replicated(key string) (string, bool) {
+	return "", false
+}
+
 func (c *EmptyCluster) Shutdown() error {
 	return nil
 }
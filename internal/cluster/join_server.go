@@ -87,6 +87,8 @@ func (s *joinServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.handleCoordinator(w, r)
 	case "/heartbeat":
 		s.handleHeartbeat(w, r)
+	case "/state":
+		s.handleState(w, r)
 	}
 }
 
@@ -280,6 +282,25 @@ func (s *joinServer) handleCoordinator(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *joinServer) handleState(w http.ResponseWriter, r *http.Request) {
+	user, pass, _ := r.BasicAuth()
+
+	if user != s.user || pass != s.pass {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		slog.Debug("JSON request cannot be decoded")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.cluster.StoreState(m)
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *joinServer) handleHeartbeat(w http.ResponseWriter, _ *http.Request) {
 	s.cluster.mu.RLock()
 	isUp := s.cluster.isUp
@@ -12,11 +12,14 @@ import (
 
 func newTestCluster(config ClusterConfig) *BullyCluster {
 	return &BullyCluster{
-		config: config,
-		nodeID: config.Node,
-		peers:  make(map[string]string),
-		isUp:   true,
-		stopCh: make(chan struct{}),
+		config:      config,
+		nodeID:      config.Node,
+		peers:       make(map[string]string),
+		isUp:        true,
+		state:       make(map[string]string),
+		pending:     make(map[string]string),
+		replicateCh: make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
 	}
 }
 
@@ -384,3 +387,83 @@ func TestCoordinatorEndpointWrongAuth(t *testing.T) {
 		t.Fatalf("Coordinator endpoint should return 400 for wrong auth, got %d", resp.StatusCode)
 	}
 }
+
+func TestStateEndpoint(t *testing.T) {
+	mgrAddr := "localhost:2345"
+	config := &ClusterConfig{Node: "node1", ManagerJoin: "", User: "my_user", Pass: "my_pass", ManagerType: "join_server", ManagerAddr: mgrAddr}
+
+	cluster := newTestCluster(*config)
+
+	js := &joinServer{addr: config.ManagerAddr, user: config.User, pass: config.Pass, cluster: cluster}
+
+	b, _ := json.Marshal(map[string]string{"sequence_000": "0|15"})
+	req := httptest.NewRequest("POST", fmt.Sprintf("http://%s/state", mgrAddr), bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth("my_user", "my_pass")
+
+	w := httptest.NewRecorder()
+
+	js.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("State endpoint should return 200, got %d", resp.StatusCode)
+	}
+
+	value, ok := cluster.Replicated("sequence_000")
+	if !ok || value != "0|15" {
+		t.Fatalf("State should be stored, got %s", value)
+	}
+}
+
+func TestStateEndpointWrongAuth(t *testing.T) {
+	mgrAddr := "localhost:2345"
+	config := &ClusterConfig{Node: "node1", ManagerJoin: "", User: "my_user", Pass: "my_pass", ManagerType: "join_server", ManagerAddr: mgrAddr}
+
+	cluster := newTestCluster(*config)
+
+	js := &joinServer{addr: config.ManagerAddr, user: config.User, pass: config.Pass, cluster: cluster}
+
+	b, _ := json.Marshal(map[string]string{"sequence_000": "0|15"})
+	req := httptest.NewRequest("POST", fmt.Sprintf("http://%s/state", mgrAddr), bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth("wrong_user", "my_pass")
+
+	w := httptest.NewRecorder()
+
+	js.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("State endpoint should return 400 for wrong auth, got %d", resp.StatusCode)
+	}
+
+	if _, ok := cluster.Replicated("sequence_000"); ok {
+		t.Fatalf("State must not be stored with wrong auth")
+	}
+}
+
+func TestReplicateState(t *testing.T) {
+	mgrAddr := "localhost:2346"
+	config := &ClusterConfig{Node: "node2", ManagerJoin: "", User: "my_user", Pass: "my_pass", ManagerType: "join_server", ManagerAddr: mgrAddr}
+
+	follower := newTestCluster(*config)
+	s := runServer(t, config, follower)
+	defer s.Close()
+
+	leader := newTestCluster(ClusterConfig{Node: "node1", User: "my_user", Pass: "my_pass"})
+	leader.Join("node2", mgrAddr)
+
+	leader.Replicate("sequence_000", "0|10")
+	leader.Replicate("sequence_000", "0|11")
+	leader.sendState()
+
+	value, ok := follower.Replicated("sequence_000")
+	if !ok || value != "0|11" {
+		t.Fatalf("The latest value should be replicated, got %s", value)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"strconv"
 
 	"github.com/spf13/viper"
 
@@ -88,7 +89,10 @@ func LoadConfig() (*Config, error) {
 	//TODO: Move this out of the config package
 	config.Connections = connectionmanager.GetConnectionManager(config.Protocol)
 
-	config.ConfigureSlots()
+	e = config.ConfigureSlots()
+	if e != nil {
+		return nil, e
+	}
 
 	e = config.LoadUsers()
 	if e != nil {
@@ -162,13 +166,31 @@ func (c *Config) LoadUsers() error {
 			c.Users[key] = u
 		}
 	}
+
+	if viper.IsSet("admins") {
+		for _, name := range viper.GetStringSlice("admins") {
+			u, ok := c.Users[name]
+			if !ok {
+				return fmt.Errorf("admin user is not defined in users: %s", name)
+			}
+
+			u.Admin = true
+			c.Users[name] = u
+		}
+	}
 	return nil
 }
 
-func (c *Config) ConfigureSlots() {
+func (c *Config) ConfigureSlots() error {
+	parents := make(map[int]string)
+	computed := make(map[int]bool)
 	for i := 0; i < 1000; i++ {
 		key := fmt.Sprintf("slot_%03d", i)
 		num := fmt.Sprintf("%03d", i)
+		if viper.IsSet(key) && slots.IsSystemSlot(i) {
+			return fmt.Errorf("slot is reserved for the system values: %s", key)
+		}
+
 		if viper.IsSet(key) {
 			sub := viper.Sub(key)
 			slot, _ := slots.GetSlot(sub, c.Connections, num)
@@ -176,8 +198,69 @@ func (c *Config) ConfigureSlots() {
 			if sub.GetString("kind") == "broadcast" {
 				c.StreamingSlots[i] = true
 			}
+			if sub.IsSet("parent") {
+				parents[i] = sub.GetString("parent")
+			}
+			if sub.GetString("kind") == "computed" {
+				computed[i] = true
+			}
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		parent, ok := parents[i]
+		if !ok {
+			continue
+		}
+
+		err := c.configureParent(i, parent)
+		if err != nil {
+			slog.Error("Error configuring parent of slot, the slot is disabled",
+				slog.Int("slot", i),
+				slog.Any("error", err),
+			)
+			c.Slots[i] = nil
 		}
 	}
+
+	// Computed slots are resolved last, after the slots with an invalid
+	// parent are disabled
+	for i := 0; i < 1000; i++ {
+		if !computed[i] || c.Slots[i] == nil {
+			continue
+		}
+
+		err := slots.ResolveReferences(c.Slots[i], func(id int) slots.Slot {
+			return c.Slots[id]
+		})
+		if err != nil {
+			slog.Error("Error configuring expression of slot, the slot is disabled",
+				slog.Int("slot", i),
+				slog.Any("error", err),
+			)
+			c.Slots[i] = nil
+		}
+	}
+
+	return nil
+}
+
+// configureParent makes the slot take its tokens from the parent slot.
+func (c *Config) configureParent(i int, parent string) error {
+	if c.Slots[i] == nil {
+		return nil
+	}
+
+	parentID, err := strconv.Atoi(parent)
+	if err != nil || parentID < 0 || parentID > 999 {
+		return fmt.Errorf("parent must be a slot number: %s", parent)
+	}
+
+	if c.Slots[parentID] == nil {
+		return fmt.Errorf("parent slot %03d is not configured", parentID)
+	}
+
+	return slots.SetParent(c.Slots[i], c.Slots[parentID], fmt.Sprintf("%03d", parentID))
 }
 
 func (c *Config) ConfigureLogging() error {
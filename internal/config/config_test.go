@@ -90,6 +90,81 @@ slot_000:
 	}
 }
 
+func TestConfigureParentSlot(t *testing.T) {
+	resetViper(t, `
+slot_000:
+  kind: token_bucket
+  bucket_size: 50
+  period: second
+  parent: 1
+slot_001:
+  kind: token_bucket
+  bucket_size: 500
+  period: second
+slot_002:
+  kind: token_bucket
+  bucket_size: 50
+  period: second
+  parent: 3
+slot_003:
+  kind: simple_memory
+`)
+
+	config := DefaultConfig()
+	config.ConfigureSlots()
+
+	if config.Slots[0] == nil {
+		t.Fatalf("slot zero not configured")
+	}
+
+	if config.Slots[2] != nil {
+		t.Fatalf("slot two must be disabled with an invalid parent")
+	}
+}
+
+func TestConfigureComputedSlot(t *testing.T) {
+	resetViper(t, `
+slot_000:
+  kind: computed
+  expression: slot_001 + slot_002
+slot_001:
+  kind: atomic
+slot_002:
+  kind: atomic
+slot_003:
+  kind: computed
+  expression: slot_004 * 2
+slot_004:
+  kind: token_bucket
+  bucket_size: 50
+  period: second
+slot_005:
+  kind: computed
+  expression: slot_001 +
+`)
+
+	config := DefaultConfig()
+	config.ConfigureSlots()
+
+	if config.Slots[0] == nil {
+		t.Fatalf("slot zero not configured")
+	}
+
+	config.Slots[1].Write("40", nil)
+	config.Slots[2].Write("2", nil)
+	if config.Slots[0].Read() != "42" {
+		t.Fatalf("unexpected computed value: %s", config.Slots[0].Read())
+	}
+
+	if config.Slots[3] != nil {
+		t.Fatalf("slot three must be disabled with a limiter in the expression")
+	}
+
+	if config.Slots[5] != nil {
+		t.Fatalf("slot five must be disabled with an invalid expression")
+	}
+}
+
 func TestNotConfigureSlot(t *testing.T) {
 	resetViper(t, `
 slot_000:
@@ -107,6 +182,27 @@ slot_000:
 	}
 }
 
+func TestConfigureSystemSlot(t *testing.T) {
+	resetViper(t, `
+slot_995:
+  kind: simple_memory
+`)
+
+	config := DefaultConfig()
+	err := config.ConfigureSlots()
+	if err == nil {
+		t.Fatalf("configuring a system slot must fail")
+	}
+
+	if config.Slots[995] != nil {
+		t.Fatalf("system slots should not be configured")
+	}
+
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("the config must not load with a system slot")
+	}
+}
+
 func TestConfigureUnknownType(t *testing.T) {
 	resetViper(t, `
 slot_000:
@@ -411,6 +507,45 @@ log:
 	}
 }
 
+func TestLoadAdmins(t *testing.T) {
+	resetViper(t, `
+users:
+  pepe: SomePassword
+  service: OtherPassword
+admins:
+  - pepe
+`)
+
+	config := DefaultConfig()
+	err := config.LoadUsers()
+	if err != nil {
+		t.Fatalf("error loading users configuration: %s", err)
+	}
+
+	if !config.Users["pepe"].Admin {
+		t.Fatalf("pepe must be an admin")
+	}
+
+	if config.Users["service"].Admin {
+		t.Fatalf("service must not be an admin")
+	}
+}
+
+func TestLoadAdminsUnknownUser(t *testing.T) {
+	resetViper(t, `
+users:
+  pepe: SomePassword
+admins:
+  - bobby
+`)
+
+	config := DefaultConfig()
+	err := config.LoadUsers()
+	if err == nil {
+		t.Fatalf("admins must be defined as users")
+	}
+}
+
 func TestLoadUsers(t *testing.T) {
 	resetViper(t, `
 users:
@@ -2,6 +2,7 @@ package connectionmanager
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"log/slog"
 	"net"
@@ -29,16 +30,56 @@ type Connection struct {
 	LoggedUser  auth.User
 	IsLogged    bool
 	Username    string
+	Session     string
 	Callback    chan string
 	Buffer      []byte
 	Timeout     time.Duration
+	InBatch     bool
+	Batch       []string
+	// readable is set on the connections read by the manager, pending keeps
+	// the data received while waiting for the client to hang up
+	readable bool
+	pending  []byte
 }
 
 func (c *Connection) ReceiveMessage() (int, error) {
+	// The data received while a command was waiting is handled first, one
+	// message at a time
+	if len(c.pending) > 0 {
+		end := bytes.IndexByte(c.pending, '\n') + 1
+		if end == 0 && len(c.pending) < len(c.Buffer) {
+			// The rest of a partial message is still on the network, it
+			// is joined with the data received before
+			buf := make([]byte, len(c.Buffer)-len(c.pending))
+			size, err := c.read(buf)
+			if err != nil {
+				return 0, err
+			}
+
+			c.pending = append(c.pending, buf[:size]...)
+			end = bytes.IndexByte(c.pending, '\n') + 1
+			if end == 0 && len(c.pending) < len(c.Buffer) {
+				return 0, errs.TranscientError{Err: "Partial message received"}
+			}
+		}
+
+		if end == 0 {
+			end = len(c.pending)
+		}
+		size := copy(c.Buffer, c.pending[:end])
+		c.pending = c.pending[size:]
+		return size, nil
+	}
+
+	return c.read(c.Buffer)
+}
+
+// read receives data from the network into the buffer.
+func (c *Connection) read(buf []byte) (int, error) {
 	reader := bufio.NewReader(c.NetworkConn)
 	// Set the connection timeout in the future
 	c.NetworkConn.SetReadDeadline(time.Now().Add(c.Timeout))
-	size, err := reader.Read(c.Buffer)
+	size, err := reader.Read(buf)
 
 	if err != nil {
 		// If the error was a timeout, continue receiving data in
@@ -101,6 +142,87 @@ func (c *Connection) SendEvent(data string) error {
 	}
 }
 
+// deliver queues an event that does not answer a message from the client, it
+// uses its own callback channel so it can be called while the connection is
+// answering a message. It returns a function that waits until the event is
+// written, a PermanentError means that the event was never queued while a
+// TranscientError means that it could still reach the client.
+func (c *Connection) deliver(data string) (func() error, error) {
+	callback := make(chan string, 1)
+	event := Event{
+		id:       uuid.NewString(),
+		data:     []byte(data),
+		callback: callback,
+		timeout:  time.Now().Add(200 * time.Millisecond),
+	}
+
+	select {
+	case c.Events <- event:
+	default:
+		return nil, errs.PermanentError{Err: "Could not send event, channel full"}
+	}
+
+	return func() error {
+		select {
+		case response := <-callback:
+			if response != event.id+" OK" {
+				return errs.TranscientError{Err: "Error delivering event: " + response}
+			}
+			return nil
+		case <-time.After(200 * time.Millisecond):
+			return errs.TranscientError{Err: "Timeout waiting for callback"}
+		}
+	}, nil
+}
+
+// Hangup returns a channel that is closed when the client closes the
+// connection while a command waits, the manager does not read from the
+// connection meanwhile so it cannot notice it. It reads from the connection
+// until the returned function is called, the data received is kept for the
+// next messages. The channel is never closed on connections that are not
+// read by the manager, like the ones of HTTP requests.
+func (c *Connection) Hangup() (<-chan struct{}, func()) {
+	closed := make(chan struct{})
+	if !c.readable {
+		return closed, func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, len(c.Buffer))
+		for len(c.pending) < len(c.Buffer) {
+			c.NetworkConn.SetReadDeadline(time.Now().Add(c.Timeout))
+			size, err := c.NetworkConn.Read(buf)
+			c.pending = append(c.pending, buf[:size]...)
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+
+			if err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	return closed, func() {
+		close(stop)
+		// Wake up the read, the deadline is set again on the next message
+		c.NetworkConn.SetReadDeadline(time.Now())
+		<-done
+	}
+}
+
 func (c *Connection) EventProcessor() {
 	var eventBatch []Event
 	batchSize := 20
@@ -154,8 +276,8 @@ func (c *Connection) sendBatchedEvents(events []Event) {
 
 	// Merge events into a single message
 	var sb strings.Builder
-	validEvents := 0
-	for i, event := range events {
+	validEvents := events[:0:0]
+	for _, event := range events {
 		if time.Now().After(event.timeout) {
 			// Handle timeout events immediately
 			var b strings.Builder
@@ -166,15 +288,16 @@ func (c *Connection) sendBatchedEvents(events []Event) {
 			continue
 		}
 
-		if i > 0 {
+		// Events are separated by a newline unless they already end with one
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
 			sb.WriteString("\n")
 		}
 		sb.Write(event.data)
-		validEvents++
+		validEvents = append(validEvents, event)
 	}
 
 	// If no valid events to send, return early
-	if validEvents == 0 {
+	if len(validEvents) == 0 {
 		return
 	}
 
@@ -188,8 +311,9 @@ func (c *Connection) sendBatchedEvents(events []Event) {
 		slog.Int("event_count", len(events)),
 		slog.Int("total_size", len(batchedData)))
 
-	// Handle each event's callback individually
-	for _, event := range events {
+	// Handle each event's callback individually, the events that timed out
+	// were already answered
+	for _, event := range validEvents {
 		var b strings.Builder
 		b.Grow(40 + 8)
 		b.WriteString(event.id)
@@ -1,12 +1,26 @@
 package connectionmanager
 
+import (
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
 type CallbackFn func(int, []byte, *Connection) error
 
 type ConnectionManager interface {
 	StartListening(string) error
 	ServeConnections(CallbackFn) error
-	Broadcast(string) (string, error)
+	Broadcast(string, string, ReadChecker) (string, error)
+	Subscribe(string, string, auth.User) error
+	SubscribeAfter(string, string, auth.User, uint64, func() []string) error
+	Unsubscribe(string, string)
+	UnsubscribeAll(string)
+	Subscribers(string) int
+	Connected() int
+	Receivers(string, ReadChecker) []string
+	Send(string, string) error
+	Queue(string, string) (func() error, error)
 	Delete(string)
+	OnDelete(func(string))
 	GetAddr() string
 	Close()
 }
@@ -75,6 +75,30 @@ func loadConnection(_ *testing.T) *Connection {
 	}
 }
 
+func TestConnectionReceivePartialPending(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := loadConnection(t)
+	conn.NetworkConn = server
+	conn.Timeout = time.Second
+	// Data received while waiting, the message was not finished
+	conn.pending = []byte("w000hel")
+
+	go client.Write([]byte("lo\nr000\n"))
+
+	size, err := conn.ReceiveMessage()
+	if err != nil || string(conn.Buffer[:size]) != "w000hello\n" {
+		t.Fatalf("the partial message must be joined with the rest: %q %v", conn.Buffer[:size], err)
+	}
+
+	size, err = conn.ReceiveMessage()
+	if err != nil || string(conn.Buffer[:size]) != "r000\n" {
+		t.Fatalf("the next message must be kept: %q %v", conn.Buffer[:size], err)
+	}
+}
+
 func TestConnectionSendEventSuccess(t *testing.T) {
 	conn := loadConnection(t)
 
@@ -2,6 +2,7 @@ package connectionmanager
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -15,6 +16,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/errs"
 	"github.com/dankomiocevic/ghoti/internal/telemetry"
 )
 
@@ -61,11 +63,15 @@ func (c *chanConn) SetWriteDeadline(time.Time) error { return nil }
 
 // sseConn implements net.Conn that writes SSE-formatted events to an http.ResponseWriter.
 // Each line of data written to this conn is emitted as an SSE event.
+// On sequenced streams the events carry their sequence number (a000<seq>|<data>),
+// it is sent as the event ID and events that were already sent are skipped.
 type sseConn struct {
 	writer    http.ResponseWriter
 	flusher   http.Flusher
 	closeCh   chan struct{}
 	closeOnce sync.Once
+	sequenced bool
+	lastID    uint64
 }
 
 func newSSEConn(w http.ResponseWriter, flusher http.Flusher) *sseConn {
@@ -88,12 +94,37 @@ func (c *sseConn) Write(b []byte) (int, error) {
 		if line == "" {
 			continue
 		}
+		if c.sequenced {
+			id, ok := eventID(line)
+			if ok && id <= c.lastID {
+				continue
+			}
+			if ok {
+				c.lastID = id
+				fmt.Fprintf(c.writer, "id: %d\n", id)
+			}
+		}
 		fmt.Fprintf(c.writer, "data: %s\n\n", line)
 	}
 	c.flusher.Flush()
 	return len(b), nil
 }
 
+// eventID returns the sequence number of a numbered async event.
+func eventID(line string) (uint64, bool) {
+	if len(line) < 4 {
+		return 0, false
+	}
+
+	seq, _, found := strings.Cut(line[4:], "|")
+	if !found {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
+
 func (c *sseConn) Read([]byte) (int, error)         { return 0, io.EOF }
 func (c *sseConn) Close() error                     { c.closeOnce.Do(func() { close(c.closeCh) }); return nil }
 func (c *sseConn) RemoteAddr() net.Addr             { return nil }
@@ -106,27 +137,34 @@ func (c *sseConn) SetWriteDeadline(time.Time) error { return nil }
 //
 // HTTP endpoints:
 //   - GET  /{slot} – read slot value (e.g. GET /000); if the slot is a broadcast slot
-//     the connection is upgraded to an SSE stream that receives future events.
-//   - POST /{slot} – write slot; request body is the value (e.g. POST /000 with body "hello")
+//     the connection is upgraded to an SSE stream that receives future events, on
+//     slots with history the Last-Event-ID header replays the events missed.
+//   - POST /{slot} – write slot; request body is the value (e.g. POST /000 with body "hello"),
+//     an optional ttl query parameter sets the seconds until the value expires (e.g. POST /000?ttl=30)
+//   - GET  /slots?range={list} – read several slots at once (e.g. GET /slots?range=0-49)
 //
 // Authentication uses HTTP Basic Auth, matched against the users map provided via SetUsers.
 // Anonymous access is allowed when no credentials are sent (slots without user restrictions).
 type HTTPManager struct {
 	lock          sync.RWMutex
 	connections   map[string]Connection
+	subscriptions subscriptions
 	httpServer    *http.Server
 	wg            sync.WaitGroup
 	quit          chan interface{}
 	callback      CallbackFn
 	users         map[string]auth.User
 	streamChecker func(int) bool
+	history       func(int, string) ([]string, bool)
+	onDelete      func(string)
 }
 
 func NewHTTPManager() *HTTPManager {
 	return &HTTPManager{
-		quit:        make(chan interface{}),
-		connections: make(map[string]Connection),
-		users:       make(map[string]auth.User),
+		quit:          make(chan interface{}),
+		connections:   make(map[string]Connection),
+		subscriptions: make(subscriptions),
+		users:         make(map[string]auth.User),
 	}
 }
 
@@ -143,6 +181,14 @@ func (h *HTTPManager) SetStreamChecker(fn func(int) bool) {
 	h.streamChecker = fn
 }
 
+// SetHistory provides a function that returns the events of a slot after the
+// given last event ID and whether the events of the slot are numbered. When
+// set, SSE streams send the event IDs and replay the events missed by clients
+// that reconnect with the Last-Event-ID header.
+func (h *HTTPManager) SetHistory(fn func(int, string) ([]string, bool)) {
+	h.history = fn
+}
+
 func (h *HTTPManager) GetAddr() string {
 	if h.httpServer != nil {
 		return h.httpServer.Addr
@@ -153,6 +199,7 @@ func (h *HTTPManager) GetAddr() string {
 func (h *HTTPManager) StartListening(addr string) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", h.handleSlot)
+	mux.HandleFunc("/slots", h.handleSlots)
 	h.httpServer = &http.Server{
 		Addr:    addr,
 		Handler: mux,
@@ -181,17 +228,32 @@ func (h *HTTPManager) Close() {
 
 func (h *HTTPManager) Delete(id string) {
 	h.lock.Lock()
-	defer h.lock.Unlock()
-	if _, ok := h.connections[id]; ok {
+	_, ok := h.connections[id]
+	if ok {
 		delete(h.connections, id)
+		h.subscriptions.removeAll(id)
 		telemetry.DecrConnectedClients()
 	}
+	h.lock.Unlock()
+
+	// The hook runs without the lock, it can use the manager
+	if ok && h.onDelete != nil {
+		h.onDelete(id)
+	}
 }
 
-// Broadcast sends data to all registered SSE subscriber connections.
-func (h *HTTPManager) Broadcast(data string) (string, error) {
+// OnDelete sets a function called with the id of every SSE stream deleted.
+// Must be called before ServeConnections.
+func (h *HTTPManager) OnDelete(fn func(string)) {
+	h.onDelete = fn
+}
+
+// Broadcast sends data to the SSE streams subscribed to the slot whose user
+// can read it.
+func (h *HTTPManager) Broadcast(slot string, data string, canRead ReadChecker) (string, error) {
+	// The callback channel is never closed, the connections can still
+	// answer events that timed out after the broadcast returns
 	callback := make(chan string, 100)
-	defer close(callback)
 	dataBytes := []byte(data)
 
 	eventID := uuid.NewString()
@@ -202,26 +264,23 @@ func (h *HTTPManager) Broadcast(data string) (string, error) {
 		timeout:  time.Now().Add(200 * time.Millisecond),
 	}
 
-	h.lock.RLock()
-	connections := make([]Connection, 0, len(h.connections))
-	for _, conn := range h.connections {
-		connections = append(connections, conn)
-	}
-	h.lock.RUnlock()
-
 	sent := 0
 	received := 0
 	errors := 0
 
-	for _, conn := range connections {
+	// The events are queued holding the lock, so the streams cannot be
+	// deleted and closed meanwhile
+	h.lock.RLock()
+	for _, id := range h.subscriptions.receiversOf(slot, data, canRead) {
 		select {
-		case conn.Events <- event:
+		case h.connections[id].Events <- event:
 			sent++
 		default:
 			sent++
 			errors++
 		}
 	}
+	h.lock.RUnlock()
 
 	timeout := time.Now().Add(200 * time.Millisecond)
 outerLoop:
@@ -241,6 +300,112 @@ outerLoop:
 	return fmt.Sprintf("%d/%d/%d", received, sent, errors), nil
 }
 
+// Subscribers returns the number of SSE streams that receive the broadcasts of the slot.
+func (h *HTTPManager) Subscribers(slot string) int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.subscriptions[slot])
+}
+
+// Connected returns the number of open SSE streams, the other requests are
+// answered right away so they are not counted.
+func (h *HTTPManager) Connected() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.connections)
+}
+
+// Receivers returns the identifiers of the SSE streams subscribed to the
+// slot whose user can read it.
+func (h *HTTPManager) Receivers(slot string, canRead ReadChecker) []string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.subscriptions.receivers(slot, canRead)
+}
+
+// Subscribe makes the SSE stream receive the broadcasts of the slot, streams
+// are subscribed to the slot they are opened on.
+func (h *HTTPManager) Subscribe(slot string, id string, user auth.User) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.connections[id]; !ok {
+		return errs.PermanentError{Err: "Connection not found"}
+	}
+
+	h.subscriptions.add(slot, id, user)
+	return nil
+}
+
+// SubscribeAfter subscribes the SSE stream to the slot after sending it the
+// events returned by replay, holding the lock so no broadcast is sent in
+// between. The numbered events up to the given sequence number and the ones
+// replayed are not broadcasted to it again.
+func (h *HTTPManager) SubscribeAfter(slot string, id string, user auth.User, after uint64, events func() []string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	conn, ok := h.connections[id]
+	if !ok {
+		return errs.PermanentError{Err: "Connection not found"}
+	}
+
+	after, err := replay(conn, events(), after)
+	if err != nil {
+		return err
+	}
+
+	h.subscriptions.addAfter(slot, id, user, after)
+	return nil
+}
+
+// Unsubscribe stops sending the broadcasts of the slot to the SSE stream.
+func (h *HTTPManager) Unsubscribe(slot string, id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.subscriptions.remove(slot, id)
+}
+
+// UnsubscribeAll removes the SSE stream from every slot it is subscribed to.
+func (h *HTTPManager) UnsubscribeAll(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.subscriptions.removeAll(id)
+}
+
+// Send delivers the data to a single SSE stream, it fails if the stream is
+// closed. Connections used for a single request are never found.
+func (h *HTTPManager) Send(id string, data string) error {
+	wait, err := h.Queue(id, data)
+	if err != nil {
+		return err
+	}
+
+	return wait()
+}
+
+// Queue queues the data in a single connection and returns a function that
+// waits until it is written, the data queued in a connection is written in
+// order.
+func (h *HTTPManager) Queue(id string, data string) (func() error, error) {
+	// The event is queued holding the lock, so the connection cannot be
+	// closed meanwhile, and the lock is released while waiting for it
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	conn, ok := h.connections[id]
+	if !ok {
+		return nil, errs.PermanentError{Err: "Connection not found"}
+	}
+
+	return conn.deliver(data)
+}
+
 // createConnection builds a Connection wrapping the provided net.Conn.
 func (h *HTTPManager) createConnection(nc net.Conn) Connection {
 	return Connection{
@@ -255,11 +420,12 @@ func (h *HTTPManager) createConnection(nc net.Conn) Connection {
 	}
 }
 
-// addSSEConnection registers an SSE connection in the broadcast map.
-func (h *HTTPManager) addSSEConnection(conn Connection) {
+// addSSEConnection registers an SSE connection subscribed to the slot.
+func (h *HTTPManager) addSSEConnection(conn Connection, slot string) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 	h.connections[conn.ID] = conn
+	h.subscriptions.add(slot, conn.ID, conn.LoggedUser)
 	telemetry.IncrConnectedClients()
 }
 
@@ -284,11 +450,19 @@ func (h *HTTPManager) authenticate(r *http.Request) (auth.User, bool) {
 // is upgraded to an SSE stream and kept open until the client disconnects; broadcast
 // events are delivered as SSE data lines.
 //
-// For GET on any other slot, the current value is returned immediately.
+// For GET on any other slot, the current value is returned immediately, the
+// key query parameter selects the key on keyed slots (GET /003?key=customer).
+// With the version query parameter the request waits for a value newer than
+// the version, up to the seconds of the wait parameter, and returns the new
+// version in the X-Ghoti-Version header (GET /000?version=4&wait=30).
 // For POST, the request body (up to 36 bytes) is written to the slot.
+// POST /{slot}/release and POST /{slot}/renew release or renew the ownership
+// of a timeout_memory slot, the X-Ghoti-Session header identifies the owner
+// on slots owned by session.
 func (h *HTTPManager) handleSlot(w http.ResponseWriter, r *http.Request) {
 	// Parse the 3-digit slot number from the URL path.
 	path := strings.TrimPrefix(r.URL.Path, "/")
+	path, action, _ := strings.Cut(path, "/")
 	if len(path) != 3 {
 		http.Error(w, "slot must be a 3-digit number (e.g. GET /000)", http.StatusBadRequest)
 		return
@@ -305,7 +479,7 @@ func (h *HTTPManager) handleSlot(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		slotNum, err := strconv.Atoi(path)
 		if err == nil && h.streamChecker != nil && h.streamChecker(slotNum) {
-			h.openBroadcastStream(w, r, user)
+			h.openBroadcastStream(w, r, user, path)
 			return
 		}
 	}
@@ -316,22 +490,34 @@ func (h *HTTPManager) handleSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fconn := newChanConn()
-	conn := h.createConnection(fconn)
-	conn.LoggedUser = user
-	if user.Name != "" {
-		conn.Username = user.Name
-		conn.IsLogged = true
-	}
-
-	defer conn.Close()
-	go conn.EventProcessor()
-
 	var msgStr string
-	switch r.Method {
-	case http.MethodGet:
-		msgStr = "r" + path
-	case http.MethodPost:
+	switch {
+	case action != "" && r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case action == "release":
+		msgStr = "f" + path
+	case action == "renew":
+		msgStr = "h" + path
+	case action != "":
+		http.Error(w, "unknown action (use release or renew)", http.StatusNotFound)
+		return
+	case r.Method == http.MethodGet && r.URL.Query().Has("version"):
+		msgStr = "n" + path + r.URL.Query().Get("version")
+		if wait := r.URL.Query().Get("wait"); wait != "" {
+			msgStr += "|" + wait
+		}
+		if len(msgStr) > 40 {
+			http.Error(w, "version too long", http.StatusBadRequest)
+			return
+		}
+	case r.Method == http.MethodGet:
+		msgStr = "r" + path + r.URL.Query().Get("key")
+		if len(msgStr) > 40 {
+			http.Error(w, "key too long", http.StatusBadRequest)
+			return
+		}
+	case r.Method == http.MethodPost:
 		body, err := io.ReadAll(io.LimitReader(r.Body, 37))
 		if err != nil {
 			http.Error(w, "error reading request body", http.StatusBadRequest)
@@ -343,32 +529,141 @@ func (h *HTTPManager) handleSlot(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		msgStr = "w" + path + value
+		if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+			msgStr = "t" + path + ttl + "|" + value
+			if len(msgStr) > 40 {
+				http.Error(w, "value too long for the ttl", http.StatusBadRequest)
+				return
+			}
+		}
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	response, err := h.sendCommand(r.Context(), user, r.Header.Get("X-Ghoti-Session"), msgStr)
+	if err != nil {
+		http.Error(w, "timeout waiting for server response", http.StatusGatewayTimeout)
+		return
+	}
+
+	// Blocking reads return the version before the value
+	if msgStr[0] == 'n' && strings.HasPrefix(response, "v") && len(response) >= 4 {
+		version, value, _ := strings.Cut(response[4:], "|")
+		w.Header().Set("X-Ghoti-Version", version)
+		response = response[:4] + value
+	}
+
+	h.writeHTTPResponse(w, response)
+}
+
+// handleSlots handles GET /slots?range=000-049, reading several slots in a single
+// request. The range uses the same format as the multi-read command: a comma
+// separated list of slots or ranges of slots (e.g. "0-49" or "1,5,10-12").
+//
+// The response is a JSON object with the value of every slot that could be read,
+// slots that are not configured or cannot be read by the user are not included.
+func (h *HTTPManager) handleSlots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ghoti"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	slotRange := r.URL.Query().Get("range")
+	if len(slotRange) == 0 || len(slotRange) > 39 {
+		http.Error(w, "range must be a list of slots (e.g. GET /slots?range=0-49)", http.StatusBadRequest)
+		return
+	}
+
+	if h.callback == nil {
+		http.Error(w, "server not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	response, err := h.sendCommand(r.Context(), user, "", "l"+slotRange)
+	if err != nil {
+		http.Error(w, "timeout waiting for server response", http.StatusGatewayTimeout)
+		return
+	}
+
+	if !strings.HasPrefix(response, "l") {
+		h.writeHTTPResponse(w, response)
+		return
+	}
+
+	values := make(map[string]string)
+	lines := strings.Split(strings.TrimRight(response, "\n"), "\n")
+	for _, line := range lines[1:] {
+		if len(line) >= 4 && line[0] == 'v' {
+			values[line[1:4]] = line[4:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(values) //nolint:errcheck
+}
+
+// sendCommand executes a single protocol command on behalf of the user and
+// returns the raw protocol response. The session identifies the client on
+// slots owned by session, since every request uses a new connection.
+// Commands that wait, like blocking reads, stop when the request is
+// cancelled or the manager is closed.
+func (h *HTTPManager) sendCommand(ctx context.Context, user auth.User, session string, msgStr string) (string, error) {
+	fconn := newChanConn()
+	conn := h.createConnection(fconn)
+	conn.LoggedUser = user
+	conn.Session = session
+	if user.Name != "" {
+		conn.Username = user.Name
+		conn.IsLogged = true
+	}
+
+	defer conn.Close()
+	go conn.EventProcessor()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.quit:
+		case <-done:
+			return
+		}
+		close(conn.Quit)
+	}()
+
 	msgBytes := []byte(msgStr + "\n")
 	if err := h.callback(len(msgStr), msgBytes, &conn); err != nil {
 		slog.Debug("HTTP callback returned error",
-			slog.String("path", r.URL.Path),
+			slog.String("command", msgStr),
 			slog.Any("error", err),
 		)
 	}
 
 	select {
 	case data := <-fconn.writeCh:
-		h.writeHTTPResponse(w, string(data))
+		return string(data), nil
 	case <-time.After(500 * time.Millisecond):
-		http.Error(w, "timeout waiting for server response", http.StatusGatewayTimeout)
+		return "", fmt.Errorf("timeout waiting for server response")
 	}
 }
 
 // writeHTTPResponse translates a ghoti protocol response line into an HTTP response.
 //
 //	v000value  → 200 OK, body: "value"
-//	e000006    → 403 Forbidden  (WRITE_PERMISSION / READ_PERMISSION)
+//	l000N      → 200 OK, body: JSON list with the values of the N lines
+//	e000006    → 403 Forbidden  (WRITE_PERMISSION / READ_PERMISSION / ADMIN_PERMISSION)
 //	e000005    → 404 Not Found  (MISSING_SLOT)
+//	e000014    → 409 Conflict   (NOT_OWNER)
 //	e000000    → 503            (NOT_LEADER)
 //	e000...    → 400 Bad Request
 func (h *HTTPManager) writeHTTPResponse(w http.ResponseWriter, response string) {
@@ -386,16 +681,28 @@ func (h *HTTPManager) writeHTTPResponse(w http.ResponseWriter, response string)
 		}
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprint(w, value)
+	case 'l':
+		values := []string{}
+		for _, line := range strings.Split(response, "\n")[1:] {
+			if len(line) >= 4 {
+				values = append(values, line[4:])
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(values) //nolint:errcheck
 	case 'e':
 		errCode := ""
 		if len(response) >= 7 {
 			errCode = response[4:7]
 		}
 		switch errCode {
-		case "006", "008": // WRITE_PERMISSION, READ_PERMISSION
+		case "006", "008", "013": // WRITE_PERMISSION, READ_PERMISSION, ADMIN_PERMISSION
 			http.Error(w, "forbidden", http.StatusForbidden)
 		case "005": // MISSING_SLOT
 			http.Error(w, "slot not configured", http.StatusNotFound)
+		case "014": // NOT_OWNER
+			http.Error(w, "not the owner of the slot", http.StatusConflict)
 		case "000": // NOT_LEADER
 			http.Error(w, "not the cluster leader", http.StatusServiceUnavailable)
 		default:
@@ -408,15 +715,28 @@ func (h *HTTPManager) writeHTTPResponse(w http.ResponseWriter, response string)
 }
 
 // openBroadcastStream upgrades a GET request on a broadcast slot to a persistent SSE stream.
-// The caller receives all future broadcast events as SSE data lines until it disconnects.
+// The caller receives all future broadcast events of the slot as SSE data lines until it
+// disconnects, users that cannot read the slot are rejected before opening the stream.
 // No immediate value is returned; the connection stays open waiting for writes to the slot.
-func (h *HTTPManager) openBroadcastStream(w http.ResponseWriter, r *http.Request, user auth.User) {
+func (h *HTTPManager) openBroadcastStream(w http.ResponseWriter, r *http.Request, user auth.User, slot string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "streaming not supported", http.StatusInternalServerError)
 		return
 	}
 
+	if h.callback != nil {
+		response, err := h.sendCommand(r.Context(), user, "", "r"+slot)
+		if err != nil {
+			http.Error(w, "timeout waiting for server response", http.StatusGatewayTimeout)
+			return
+		}
+		if !strings.HasPrefix(response, "v") {
+			h.writeHTTPResponse(w, response)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -430,7 +750,16 @@ func (h *HTTPManager) openBroadcastStream(w http.ResponseWriter, r *http.Request
 		conn.IsLogged = true
 	}
 
-	h.addSSEConnection(conn)
+	// The stream is subscribed before reading the history, so the events
+	// broadcasted meanwhile are queued instead of lost. The ones that are
+	// also in the history are skipped by their event ID.
+	h.addSSEConnection(conn, slot)
+
+	var missed []string
+	if h.history != nil {
+		slotNum, _ := strconv.Atoi(slot)
+		missed, sconn.sequenced = h.history(slotNum, r.Header.Get("Last-Event-ID"))
+	}
 
 	// Flush the response headers before starting the EventProcessor goroutine
 	// so that the initial Flush and the goroutine's Flush calls never race on
@@ -438,6 +767,13 @@ func (h *HTTPManager) openBroadcastStream(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
 
+	// The missed events are written before the EventProcessor starts, the
+	// events broadcasted meanwhile wait in the queue and the ones already
+	// replayed are skipped.
+	for _, event := range missed {
+		sconn.Write([]byte(event)) //nolint:errcheck
+	}
+
 	slog.Debug("SSE subscriber connected",
 		slog.String("id", conn.ID),
 		slog.String("remote_addr", r.RemoteAddr),
@@ -205,7 +205,7 @@ func TestHTTPManagerBroadcastSlotGetOpenSSE(t *testing.T) {
 	}
 
 	// Broadcast a message and verify the SSE subscriber receives it.
-	stats, err := h.Broadcast("a003hello\n")
+	stats, err := h.Broadcast("003", "a003hello\n", nil)
 	if err != nil {
 		t.Fatalf("Broadcast error: %v", err)
 	}
@@ -258,10 +258,316 @@ func TestHTTPManagerNonBroadcastSlotGetReturnsValue(t *testing.T) {
 	}
 }
 
+// TestHTTPManagerBroadcastSlotReplay verifies that SSE streams on slots with
+// history send the event IDs and replay the events after Last-Event-ID.
+func TestHTTPManagerBroadcastSlotReplay(t *testing.T) {
+	h := buildTestManager(echoCallback)
+	h.SetStreamChecker(func(slot int) bool { return slot == 3 })
+	h.SetHistory(func(slot int, lastEventID string) ([]string, bool) {
+		if lastEventID != "1" {
+			t.Errorf("unexpected last event ID: %q", lastEventID)
+		}
+		return []string{"a0032|missed\n"}, true
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleSlot))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/003", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("SSE connect failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The replayed event is not sent twice
+	h.Broadcast("003", "a0032|missed\n", nil)
+	h.Broadcast("003", "a0033|live\n", nil)
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if scanner.Text() != "" {
+				lines <- scanner.Text()
+			}
+		}
+	}()
+
+	expected := []string{"id: 2", "data: a0032|missed", "id: 3", "data: a0033|live"}
+	for _, want := range expected {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
+
+// TestHTTPManagerBroadcastDuringReconnect verifies that the events
+// broadcasted while a stream reconnects are neither lost nor sent twice.
+func TestHTTPManagerBroadcastDuringReconnect(t *testing.T) {
+	h := buildTestManager(echoCallback)
+	h.SetStreamChecker(func(slot int) bool { return slot == 3 })
+	h.SetHistory(func(slot int, lastEventID string) ([]string, bool) {
+		// The event 3 is broadcasted while the history is read, the event
+		// 4 is broadcasted after it
+		go func() {
+			h.Broadcast("003", "a0033|during\n", nil)
+			h.Broadcast("003", "a0034|after\n", nil)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		return []string{"a0032|missed\n", "a0033|during\n"}, true
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleSlot))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/003", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("SSE connect failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				lines <- scanner.Text()
+			}
+		}
+	}()
+
+	expected := []string{"data: a0032|missed", "data: a0033|during", "data: a0034|after"}
+	for _, want := range expected {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	select {
+	case got := <-lines:
+		t.Fatalf("unexpected event %q", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// TestHTTPManagerBroadcastSlotForbidden verifies that users that cannot read
+// a broadcast slot are rejected instead of opening an SSE stream.
+func TestHTTPManagerBroadcastSlotForbidden(t *testing.T) {
+	h := buildTestManager(errorCallback)
+	h.SetStreamChecker(func(slot int) bool { return slot == 3 })
+
+	req := httptest.NewRequest(http.MethodGet, "/003", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a slot that cannot be read, got %d", rr.Code)
+	}
+
+	if h.Subscribers("003") != 0 {
+		t.Fatalf("rejected streams must not be subscribed")
+	}
+}
+
+// TestHTTPManagerAcknowledgedWrite verifies that framed responses, like the
+// connections that acknowledged a reliable broadcast, are returned as JSON.
+func TestHTTPManagerAcknowledgedWrite(t *testing.T) {
+	h := buildTestManager(func(size int, data []byte, conn *Connection) error {
+		return conn.SendEvent("l0032\nv003first\nv003second\n")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/003", strings.NewReader("hello"))
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if body := strings.TrimSpace(rr.Body.String()); body != `["first","second"]` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestHTTPManagerWriteWithTTL(t *testing.T) {
+	received := make(chan string, 1)
+	h := buildTestManager(func(size int, data []byte, conn *Connection) error {
+		received <- string(data[:size])
+		return conn.SendEvent("v000hello\n")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/000?ttl=30", strings.NewReader("hello"))
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if msg := <-received; msg != "t00030|hello" {
+		t.Fatalf("unexpected command sent to the server: %q", msg)
+	}
+}
+
+func TestHTTPManagerReadWithKey(t *testing.T) {
+	received := make(chan string, 1)
+	h := buildTestManager(func(size int, data []byte, conn *Connection) error {
+		received <- string(data[:size])
+		return conn.SendEvent("v0001\n")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/000?key=customer42", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if msg := <-received; msg != "r000customer42" {
+		t.Fatalf("unexpected command sent to the server: %q", msg)
+	}
+}
+
+func TestHTTPManagerBlockingRead(t *testing.T) {
+	received := make(chan string, 1)
+	h := buildTestManager(func(size int, data []byte, conn *Connection) error {
+		received <- string(data[:size])
+		return conn.SendEvent("v0005|value\n")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/000?version=4&wait=10", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if msg := <-received; msg != "n0004|10" {
+		t.Fatalf("unexpected command sent to the server: %q", msg)
+	}
+
+	if version := rr.Header().Get("X-Ghoti-Version"); version != "5" {
+		t.Fatalf("unexpected version header: %q", version)
+	}
+
+	if body := rr.Body.String(); body != "value" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestHTTPManagerReleaseWithSession(t *testing.T) {
+	received := make(chan string, 1)
+	h := buildTestManager(func(size int, data []byte, conn *Connection) error {
+		received <- conn.Session + " " + string(data[:size])
+		return conn.SendEvent("e000014\n")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/000/release", nil)
+	req.Header.Set("X-Ghoti-Session", "worker-1")
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if msg := <-received; msg != "worker-1 f000" {
+		t.Fatalf("unexpected command sent to the server: %q", msg)
+	}
+}
+
+func TestHTTPManagerUnknownAction(t *testing.T) {
+	h := buildTestManager(echoCallback)
+
+	req := httptest.NewRequest(http.MethodPost, "/000/unknown", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlot(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// listCallback simulates a server answering a multi-read with a framed response.
+func listCallback(size int, data []byte, conn *Connection) error {
+	msg := string(data[:size])
+	if msg != "l0-2" {
+		return conn.SendEvent("exxx009\n")
+	}
+	return conn.SendEvent("lxxx3\nv000hello\ne001008\nv002world\n")
+}
+
+func TestHTTPManagerReadRange(t *testing.T) {
+	h := buildTestManager(listCallback)
+
+	req := httptest.NewRequest(http.MethodGet, "/slots?range=0-2", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlots(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	expected := `{"000":"hello","002":"world"}` + "\n"
+	if rr.Body.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, rr.Body.String())
+	}
+}
+
+func TestHTTPManagerReadRangeInvalid(t *testing.T) {
+	h := buildTestManager(listCallback)
+
+	req := httptest.NewRequest(http.MethodGet, "/slots?range=5-1", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlots(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHTTPManagerReadRangeMissing(t *testing.T) {
+	h := buildTestManager(listCallback)
+
+	req := httptest.NewRequest(http.MethodGet, "/slots", nil)
+	rr := httptest.NewRecorder()
+
+	h.handleSlots(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestHTTPManagerBroadcastWithNoSubscribers(t *testing.T) {
 	h := buildTestManager(echoCallback)
 
-	stats, err := h.Broadcast("a000test\n")
+	stats, err := h.Broadcast("000", "a000test\n", nil)
 	if err != nil {
 		t.Fatalf("Broadcast error: %v", err)
 	}
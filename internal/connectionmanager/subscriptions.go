@@ -0,0 +1,98 @@
+package connectionmanager
+
+import (
+	"strings"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// ReadChecker reports whether a user can read a slot, broadcasts use it to
+// skip the subscribers that cannot read the slot anymore.
+type ReadChecker func(*auth.User) bool
+
+// subscriber is a connection subscribed to a slot along with the user that
+// subscribed it. Numbered events up to after were replayed when it
+// subscribed, so they are not broadcasted to it again.
+type subscriber struct {
+	user  auth.User
+	after uint64
+}
+
+// subscriptions keeps the connections subscribed to every slot. It is not
+// safe for concurrent use, the managers protect it with their own lock.
+type subscriptions map[string]map[string]subscriber
+
+func (s subscriptions) add(slot string, id string, user auth.User) {
+	s.addAfter(slot, id, user, 0)
+}
+
+// addAfter subscribes the connection skipping the numbered events up to
+// the given sequence number.
+func (s subscriptions) addAfter(slot string, id string, user auth.User, after uint64) {
+	if s[slot] == nil {
+		s[slot] = make(map[string]subscriber)
+	}
+	s[slot][id] = subscriber{user: user, after: after}
+}
+
+func (s subscriptions) remove(slot string, id string) {
+	delete(s[slot], id)
+	if len(s[slot]) == 0 {
+		delete(s, slot)
+	}
+}
+
+// removeAll removes the connection from every slot.
+func (s subscriptions) removeAll(id string) {
+	for slot := range s {
+		s.remove(slot, id)
+	}
+}
+
+// receivers returns the identifiers of the connections subscribed to the
+// slot whose user can read it.
+func (s subscriptions) receivers(slot string, canRead ReadChecker) []string {
+	return s.receiversOf(slot, "", canRead)
+}
+
+// receiversOf returns the identifiers of the connections that must receive
+// the event, the connections that already received it when they subscribed
+// are skipped.
+func (s subscriptions) receiversOf(slot string, data string, canRead ReadChecker) []string {
+	seq, numbered := eventID(data)
+	ids := make([]string, 0, len(s[slot]))
+	for id, sub := range s[slot] {
+		if canRead != nil && !canRead(&sub.user) {
+			continue
+		}
+		if numbered && sub.after > 0 && seq <= sub.after {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// replay queues the events in the connection and returns the highest
+// sequence number among them, it must be called holding the lock of the
+// manager so no broadcast is queued in between. The events are queued as a
+// single event, so any number of them fits in the queue of the connection.
+func replay(conn Connection, events []string, after uint64) (uint64, error) {
+	if len(events) == 0 {
+		return after, nil
+	}
+
+	var sb strings.Builder
+	for _, event := range events {
+		sb.WriteString(event)
+		if seq, ok := eventID(event); ok {
+			after = max(after, seq)
+		}
+	}
+
+	if _, err := conn.deliver(sb.String()); err != nil {
+		return 0, err
+	}
+	return after, nil
+}
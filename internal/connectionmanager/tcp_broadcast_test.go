@@ -1,12 +1,16 @@
 package connectionmanager
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
 )
 
 // This is a mock for net.Conn.
@@ -82,13 +86,18 @@ func TestBroadcast(t *testing.T) {
 
 	// Create a new TCPManager
 	manager := TCPManager{
-		connections: connections,
-		quit:        make(chan interface{}),
-		lock:        sync.RWMutex{},
+		connections:   connections,
+		subscriptions: make(subscriptions),
+		quit:          make(chan interface{}),
+		lock:          sync.RWMutex{},
+	}
+
+	for id := range connections {
+		manager.Subscribe("001", id, auth.User{})
 	}
 
 	go func() {
-		output, err := manager.Broadcast("Hello World")
+		output, err := manager.Broadcast("001", "Hello World", nil)
 		if err != nil {
 			t.Errorf("Error broadcasting message: %s", err)
 		}
@@ -152,13 +161,18 @@ func benchmarkBroadcast(x int, b *testing.B) {
 
 		// Create a new TCPManager
 		manager := TCPManager{
-			connections: connections,
-			quit:        make(chan interface{}),
-			lock:        sync.RWMutex{},
+			connections:   connections,
+			subscriptions: make(subscriptions),
+			quit:          make(chan interface{}),
+			lock:          sync.RWMutex{},
+		}
+
+		for id := range connections {
+			manager.Subscribe("001", id, auth.User{})
 		}
 
 		b.StartTimer()
-		_, err := manager.Broadcast("Hello World")
+		_, err := manager.Broadcast("001", "Hello World", nil)
 		if err != nil {
 			b.Errorf("Error broadcasting message: %s", err)
 		}
@@ -180,3 +194,192 @@ func BenchmarkBroadcast100(b *testing.B) {
 func BenchmarkBroadcast1000(b *testing.B) {
 	benchmarkBroadcast(1000, b)
 }
+
+// This test checks that broadcasts are only sent to the connections subscribed
+// to the slot whose user can read it.
+func TestBroadcastSubscribers(t *testing.T) {
+	manager := NewTCPManager()
+
+	clients := make(map[string]net.Conn)
+	for _, id := range []string{"reader", "other", "denied", "unsubscribed"} {
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+
+		c := &Connection{
+			ID:          id,
+			Quit:        make(chan interface{}),
+			Events:      make(chan Event, 10),
+			NetworkConn: server,
+			Callback:    make(chan string, 10),
+			Buffer:      make([]byte, 1024),
+			Timeout:     200,
+		}
+		manager.connections[id] = *c
+		clients[id] = client
+		go c.EventProcessor()
+	}
+
+	manager.Subscribe("001", "reader", auth.User{Name: "reader"})
+	manager.Subscribe("002", "other", auth.User{Name: "reader"})
+	manager.Subscribe("001", "denied", auth.User{Name: "denied"})
+	manager.Subscribe("001", "unsubscribed", auth.User{Name: "reader"})
+	manager.Unsubscribe("001", "unsubscribed")
+
+	if err := manager.Subscribe("001", "missing", auth.User{}); err == nil {
+		t.Fatalf("Subscribing a missing connection must fail")
+	}
+
+	if manager.Subscribers("001") != 2 {
+		t.Fatalf("Expected 2 subscribers, got %d", manager.Subscribers("001"))
+	}
+
+	canRead := func(u *auth.User) bool { return u.Name == "reader" }
+
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := clients["reader"].Read(buf)
+		if string(buf[:n]) != "a001Hello\n" {
+			t.Errorf("Expected 'a001Hello', got %s", string(buf[:n]))
+		}
+	}()
+
+	output, err := manager.Broadcast("001", "a001Hello\n", canRead)
+	if err != nil {
+		t.Fatalf("Error broadcasting message: %s", err)
+	}
+
+	if output != "1/1/0" {
+		t.Fatalf("Expected '1/1/0', got %s", output)
+	}
+
+	manager.Delete("reader")
+	if manager.Subscribers("001") != 1 {
+		t.Fatalf("Deleted connections must be unsubscribed")
+	}
+
+	manager.UnsubscribeAll("denied")
+	if manager.Subscribers("001") != 0 {
+		t.Fatalf("Expected no subscribers, got %d", manager.Subscribers("001"))
+	}
+}
+
+// This test checks that the events broadcasted while replaying the history
+// of a slot to a connection are neither lost nor sent twice.
+func TestBroadcastDuringReplay(t *testing.T) {
+	manager := NewTCPManager()
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := &Connection{
+		ID:          "late",
+		Quit:        make(chan interface{}),
+		Events:      make(chan Event, 10),
+		NetworkConn: server,
+		Callback:    make(chan string, 10),
+		Buffer:      make([]byte, 1024),
+		Timeout:     200,
+	}
+	manager.connections[c.ID] = *c
+	go c.EventProcessor()
+
+	lines := make(chan string, 10)
+	go func() {
+		reader := bufio.NewReader(client)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	err := manager.SubscribeAfter("001", "late", auth.User{}, 1, func() []string {
+		// The event 3 is already in the history when it is broadcasted
+		go func() {
+			manager.Broadcast("001", "a0013|during\n", nil)
+			manager.Broadcast("001", "a0014|live\n", nil)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		return []string{"a0012|missed\n", "a0013|during\n"}
+	})
+	if err != nil {
+		t.Fatalf("Error subscribing: %s", err)
+	}
+
+	for _, expected := range []string{"a0012|missed\n", "a0013|during\n", "a0014|live\n"} {
+		select {
+		case line := <-lines:
+			if line != expected {
+				t.Fatalf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", expected)
+		}
+	}
+
+	select {
+	case line := <-lines:
+		t.Fatalf("Unexpected event: %q", line)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestReplayLargeHistory(t *testing.T) {
+	manager := NewTCPManager()
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := &Connection{
+		ID:          "late",
+		Quit:        make(chan interface{}),
+		Events:      make(chan Event, 128),
+		NetworkConn: server,
+		Callback:    make(chan string, 10),
+		Buffer:      make([]byte, 1024),
+		Timeout:     200,
+	}
+	manager.connections[c.ID] = *c
+	go c.EventProcessor()
+
+	lines := make(chan string, 500)
+	go func() {
+		reader := bufio.NewReader(client)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	// The history is bigger than the queue of the connection
+	history := make([]string, 400)
+	for i := range history {
+		history[i] = "a001" + strconv.Itoa(i+1) + "|event\n"
+	}
+
+	err := manager.SubscribeAfter("001", "late", auth.User{}, 0, func() []string {
+		return history
+	})
+	if err != nil {
+		t.Fatalf("Error subscribing: %s", err)
+	}
+
+	for _, expected := range history {
+		select {
+		case line := <-lines:
+			if line != expected {
+				t.Fatalf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", expected)
+		}
+	}
+}
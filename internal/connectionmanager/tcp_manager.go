@@ -16,18 +16,21 @@ import (
 )
 
 type TCPManager struct {
-	lock        sync.RWMutex
-	connections map[string]Connection
-	listener    net.Listener
-	wg          sync.WaitGroup
-	quit        chan interface{}
+	lock          sync.RWMutex
+	connections   map[string]Connection
+	subscriptions subscriptions
+	listener      net.Listener
+	wg            sync.WaitGroup
+	quit          chan interface{}
+	onDelete      func(string)
 }
 
 func NewTCPManager() *TCPManager {
 	return &TCPManager{
-		quit:        make(chan interface{}),
-		lock:        sync.RWMutex{},
-		connections: make(map[string]Connection),
+		quit:          make(chan interface{}),
+		lock:          sync.RWMutex{},
+		connections:   make(map[string]Connection),
+		subscriptions: make(subscriptions),
 	}
 }
 
@@ -73,8 +76,11 @@ func (c *TCPManager) ServeConnections(callback CallbackFn) error {
 }
 
 func (c *TCPManager) handleUserConnection(callback CallbackFn, conn Connection) {
-	defer c.Delete(conn.ID)
+	// The connection is deleted before closing it, events are only queued
+	// holding the lock of the manager, so no events are sent to a closed
+	// connection
 	defer conn.Close()
+	defer c.Delete(conn.ID)
 	slog.Debug("Handling user connection",
 		slog.String("remote_addr", conn.ID),
 		slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
@@ -170,6 +176,7 @@ func (c *TCPManager) Add(conn net.Conn, bufferSize int) Connection {
 		Callback:    make(chan string),
 		Buffer:      buf,
 		Timeout:     timeoutDuration,
+		readable:    true,
 	}
 
 	c.connections[connection.ID] = connection
@@ -179,10 +186,9 @@ func (c *TCPManager) Add(conn net.Conn, bufferSize int) Connection {
 
 func (c *TCPManager) Delete(id string) {
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
 	_, ok := c.connections[id]
 	if !ok {
+		c.lock.Unlock()
 		slog.Debug("Connection already deleted",
 			slog.String("id", id),
 		)
@@ -191,7 +197,20 @@ func (c *TCPManager) Delete(id string) {
 	}
 
 	delete(c.connections, id)
+	c.subscriptions.removeAll(id)
 	telemetry.DecrConnectedClients()
+	c.lock.Unlock()
+
+	// The hook runs without the lock, it can use the manager
+	if c.onDelete != nil {
+		c.onDelete(id)
+	}
+}
+
+// OnDelete sets a function called with the id of every connection deleted,
+// however the client disconnected. Must be called before ServeConnections.
+func (c *TCPManager) OnDelete(fn func(string)) {
+	c.onDelete = fn
 }
 
 func (c *TCPManager) Close() {
@@ -220,9 +239,117 @@ func (c *TCPManager) Close() {
 	c.wg.Wait()
 }
 
-func (c *TCPManager) Broadcast(data string) (string, error) {
+// Subscribers returns the number of connections subscribed to the slot.
+func (c *TCPManager) Subscribers(slot string) int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.subscriptions[slot])
+}
+
+// Connected returns the number of connections of the clients.
+func (c *TCPManager) Connected() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.connections)
+}
+
+// Receivers returns the identifiers of the connections subscribed to the
+// slot whose user can read it.
+func (c *TCPManager) Receivers(slot string, canRead ReadChecker) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.subscriptions.receivers(slot, canRead)
+}
+
+// Subscribe makes the connection receive the broadcasts of the slot, the
+// user is checked against the permissions of the slot on every broadcast.
+func (c *TCPManager) Subscribe(slot string, id string, user auth.User) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.connections[id]; !ok {
+		return errs.PermanentError{Err: "Connection not found"}
+	}
+
+	c.subscriptions.add(slot, id, user)
+	return nil
+}
+
+// SubscribeAfter subscribes the connection to the slot after sending it the
+// events returned by replay, holding the lock so no broadcast is sent in
+// between. The numbered events up to the given sequence number and the ones
+// replayed are not broadcasted to it again.
+func (c *TCPManager) SubscribeAfter(slot string, id string, user auth.User, after uint64, events func() []string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	conn, ok := c.connections[id]
+	if !ok {
+		return errs.PermanentError{Err: "Connection not found"}
+	}
+
+	after, err := replay(conn, events(), after)
+	if err != nil {
+		return err
+	}
+
+	c.subscriptions.addAfter(slot, id, user, after)
+	return nil
+}
+
+// Unsubscribe stops sending the broadcasts of the slot to the connection.
+func (c *TCPManager) Unsubscribe(slot string, id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscriptions.remove(slot, id)
+}
+
+// UnsubscribeAll removes the connection from every slot it is subscribed to.
+func (c *TCPManager) UnsubscribeAll(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscriptions.removeAll(id)
+}
+
+// Send delivers the data to a single connection, it fails if the connection
+// is not connected anymore.
+func (c *TCPManager) Send(id string, data string) error {
+	wait, err := c.Queue(id, data)
+	if err != nil {
+		return err
+	}
+
+	return wait()
+}
+
+// Queue queues the data in a single connection and returns a function that
+// waits until it is written, the data queued in a connection is written in
+// order.
+func (c *TCPManager) Queue(id string, data string) (func() error, error) {
+	// The event is queued holding the lock, so the connection cannot be
+	// closed meanwhile, and the lock is released while waiting for it
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	conn, ok := c.connections[id]
+	if !ok {
+		return nil, errs.PermanentError{Err: "Connection not found"}
+	}
+
+	return conn.deliver(data)
+}
+
+// Broadcast sends the data to the connections subscribed to the slot whose
+// user can read it, it returns the received, sent and failed deliveries.
+func (c *TCPManager) Broadcast(slot string, data string, canRead ReadChecker) (string, error) {
+	// The callback channel is never closed, the connections can still
+	// answer events that timed out after the broadcast returns
 	callback := make(chan string, 100)
-	defer close(callback)
 	dataBytes := []byte(data)
 
 	eventID := uuid.NewString()
@@ -237,9 +364,11 @@ func (c *TCPManager) Broadcast(data string) (string, error) {
 	received := 0
 	errors := 0
 
-	// Fix the concurrency issue here with range when removing connections on
-	// another goroutine
-	for _, conn := range c.connections {
+	// The events are queued holding the lock, so the connections cannot be
+	// deleted and closed meanwhile
+	c.lock.RLock()
+	for _, id := range c.subscriptions.receiversOf(slot, data, canRead) {
+		conn := c.connections[id]
 		select {
 		case conn.Events <- event:
 			sent++
@@ -263,6 +392,7 @@ func (c *TCPManager) Broadcast(data string) (string, error) {
 			}
 		}
 	}
+	c.lock.RUnlock()
 
 	// Get the time 200 ms in the future
 	timeout := time.Now().Add(200 * time.Millisecond)
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net"
 
+	"github.com/dankomiocevic/ghoti/internal/auth"
 	"github.com/dankomiocevic/ghoti/internal/errs"
 )
 
@@ -55,8 +56,10 @@ func (m *TelnetManager) ServeConnections(callback CallbackFn) error {
 
 func (m *TelnetManager) handleUserConnection(callback CallbackFn, conn Connection) {
 	c := m.tcpManager
-	defer c.Delete(conn.ID)
+	// The connection is deleted before closing it, so no events are sent
+	// to a closed connection
 	defer conn.Close()
+	defer c.Delete(conn.ID)
 	slog.Debug("Handling user connection",
 		slog.String("remote_addr", conn.ID),
 		slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
@@ -135,10 +138,50 @@ func (m *TelnetManager) Delete(id string) {
 	m.tcpManager.Delete(id)
 }
 
+func (m *TelnetManager) OnDelete(fn func(string)) {
+	m.tcpManager.OnDelete(fn)
+}
+
 func (m *TelnetManager) Close() {
 	m.tcpManager.Close()
 }
 
-func (m *TelnetManager) Broadcast(data string) (string, error) {
-	return m.tcpManager.Broadcast(data)
+func (m *TelnetManager) Subscribers(slot string) int {
+	return m.tcpManager.Subscribers(slot)
+}
+
+func (m *TelnetManager) Connected() int {
+	return m.tcpManager.Connected()
+}
+
+func (m *TelnetManager) Send(id string, data string) error {
+	return m.tcpManager.Send(id, data)
+}
+
+func (m *TelnetManager) Queue(id string, data string) (func() error, error) {
+	return m.tcpManager.Queue(id, data)
+}
+
+func (m *TelnetManager) Receivers(slot string, canRead ReadChecker) []string {
+	return m.tcpManager.Receivers(slot, canRead)
+}
+
+func (m *TelnetManager) Subscribe(slot string, id string, user auth.User) error {
+	return m.tcpManager.Subscribe(slot, id, user)
+}
+
+func (m *TelnetManager) SubscribeAfter(slot string, id string, user auth.User, after uint64, events func() []string) error {
+	return m.tcpManager.SubscribeAfter(slot, id, user, after, events)
+}
+
+func (m *TelnetManager) Unsubscribe(slot string, id string) {
+	m.tcpManager.Unsubscribe(slot, id)
+}
+
+func (m *TelnetManager) UnsubscribeAll(id string) {
+	m.tcpManager.UnsubscribeAll(id)
+}
+
+func (m *TelnetManager) Broadcast(slot string, data string, canRead ReadChecker) (string, error) {
+	return m.tcpManager.Broadcast(slot, data, canRead)
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Message struct {
@@ -20,6 +21,23 @@ var SupportedCommands = map[string]bool{
 	"p": true,
 	"j": true,
 	"q": true,
+	"m": true,
+	"x": true,
+	"c": true,
+	"l": true,
+	"i": true,
+	"z": true,
+	"t": true,
+	"k": true,
+	"f": true,
+	"h": true,
+	"b": true,
+	"g": true,
+	"s": true,
+	"d": true,
+	"y": true,
+	"o": true,
+	"n": true,
 }
 
 func ParseMessage(size int, buf []byte) (Message, error) {
@@ -27,8 +45,8 @@ func ParseMessage(size int, buf []byte) (Message, error) {
 	command := input[:1]
 	fmt.Printf("Input: [%s]\n", input)
 
-	if command == "q" {
-		return Message{Command: buf[0], Slot: 0, Value: ""}, nil
+	if command == "q" || command == "m" || command == "x" {
+		return Message{Raw: input, Command: buf[0], Slot: 0, Value: ""}, nil
 	}
 
 	if len(input) < 4 {
@@ -43,7 +61,7 @@ func ParseMessage(size int, buf []byte) (Message, error) {
 		return Message{}, errors.New("command not supported")
 	}
 
-	if command == "u" || command == "p" {
+	if command == "u" || command == "p" || command == "l" || command == "k" {
 		return Message{Command: []byte(command)[0], Slot: 0, Value: input[1:]}, nil
 	}
 
@@ -53,9 +71,41 @@ func ParseMessage(size int, buf []byte) (Message, error) {
 	}
 
 	var value string
-	if command == "w" {
+	if command == "w" || command == "c" || command == "t" || command == "b" || command == "g" || command == "r" || command == "s" || command == "y" || command == "o" || command == "n" {
 		value = input[4:]
 	}
 
 	return Message{Raw: input, Command: []byte(command)[0], Slot: slot, Value: value}, nil
 }
+
+// parseSlotList parses a comma separated list of slots and ranges of slots,
+// for example "000-049" or "001,005,010-012". Ranges include both ends.
+func parseSlotList(list string) ([]int, error) {
+	var slotIDs []int
+	for _, item := range strings.Split(list, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		if !isRange {
+			to = from
+		}
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, errors.New("malformed slot")
+		}
+
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, errors.New("malformed slot")
+		}
+
+		if start < 0 || end > 999 || start > end {
+			return nil, errors.New("invalid slot range")
+		}
+
+		for i := start; i <= end; i++ {
+			slotIDs = append(slotIDs, i)
+		}
+	}
+
+	return slotIDs, nil
+}
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
@@ -15,16 +21,32 @@ import (
 	"github.com/dankomiocevic/ghoti/internal/telemetry"
 )
 
+// maxBatchSize is the maximum number of commands that can be queued in a batch.
+const maxBatchSize = 32
+
+// listPageSize is the maximum number of entries returned when listing a slot.
+const listPageSize = 50
+
+// defaultReadWait and maxReadWait are the time blocking reads wait for a
+// new value when the client does not set it and the maximum it can set.
+const (
+	defaultReadWait = 30 * time.Second
+	maxReadWait     = 300 * time.Second
+)
+
 type Server struct {
 	slotsArray  [1000]slots.Slot
+	slotLocks   [1000]sync.Mutex
 	usersMap    map[string]auth.User
 	connections connectionmanager.ConnectionManager
 	cluster     cluster.Cluster
+	watches     *watchList
 }
 
 func NewServer(config *config.Config, cluster cluster.Cluster) *Server {
 	s := &Server{
 		cluster: cluster,
+		watches: newWatchList(),
 	}
 
 	slog.Info("Starting server...")
@@ -36,6 +58,15 @@ func NewServer(config *config.Config, cluster cluster.Cluster) *Server {
 	s.slotsArray = config.Slots
 	s.usersMap = config.Users
 
+	// The last slots are reserved for the facts of the server
+	for id, slot := range slots.NewSystemSlots(s.connections) {
+		s.slotsArray[id] = slot
+	}
+
+	for _, slot := range s.slotsArray {
+		slots.SetServer(slot, cluster, config.Protocol)
+	}
+
 	// Provide the users map to the HTTP manager so it can verify Basic Auth credentials,
 	// and the pre-computed set of streaming (broadcast) slot indices from config.
 	if httpMgr, ok := s.connections.(*connectionmanager.HTTPManager); ok {
@@ -43,8 +74,12 @@ func NewServer(config *config.Config, cluster cluster.Cluster) *Server {
 		httpMgr.SetStreamChecker(func(slot int) bool {
 			return config.StreamingSlots[slot]
 		})
+		httpMgr.SetHistory(s.history)
 	}
 
+	// The watches of a client are removed however it disconnects
+	s.connections.OnDelete(s.watches.removeAll)
+
 	go s.connections.ServeConnections(s.HandleMessage)
 	return s
 }
@@ -70,6 +105,7 @@ func (s *Server) HandleMessage(size int, data []byte, conn *connectionmanager.Co
 	currentSlot := s.slotsArray[msg.Slot]
 
 	if msg.Command == 'q' {
+		s.watches.removeAll(conn.ID)
 		slog.Debug("Client disconnected",
 			slog.String("id", conn.ID),
 			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
@@ -85,14 +121,34 @@ func (s *Server) HandleMessage(size int, data []byte, conn *connectionmanager.Co
 		return conn.SendEvent(res.Response("xxx") + s.cluster.GetLeader())
 	}
 
+	if msg.Command == 'm' {
+		return processBatchStart(conn)
+	}
+
+	if msg.Command == 'x' {
+		return s.processBatch(conn)
+	}
+
+	if conn.InBatch {
+		return queueBatchCommand(conn, msg)
+	}
+
 	if msg.Command == 'u' {
-		return processUsername(conn, msg)
+		return processUsername(s, conn, msg)
 	}
 
 	if msg.Command == 'p' {
 		return processPassword(s, conn, msg)
 	}
 
+	if msg.Command == 'k' {
+		return processSession(conn, msg)
+	}
+
+	if msg.Command == 'l' {
+		return s.processMultiRead(conn, msg)
+	}
+
 	if currentSlot == nil {
 		res := errs.Error("MISSING_SLOT")
 		slog.Debug("Missing slot",
@@ -103,6 +159,48 @@ func (s *Server) HandleMessage(size int, data []byte, conn *connectionmanager.Co
 		return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
 	}
 
+	// Acknowledgements do not take the lock of the slot, the write waiting
+	// for them holds it
+	if msg.Command == 'y' {
+		return processAck(conn, currentSlot, msg)
+	}
+
+	// Blocking reads wait for the slot to change, so they cannot hold the
+	// lock of the slot
+	if msg.Command == 'n' {
+		return processBlockingRead(conn, currentSlot, msg)
+	}
+
+	// Acknowledged writes wait for the subscribers, so they do not hold the
+	// lock of the slot. The slot serializes them with its own write lock
+	// until the event is queued, the waits for the acks can overlap
+	if acknowledger, ok := currentSlot.(slots.Acknowledger); ok && acknowledger.IsReliable() && (msg.Command == 'w' || msg.Command == 't') {
+		return processAcknowledgedWrite(conn, currentSlot, acknowledger, msg)
+	}
+
+	s.slotLocks[msg.Slot].Lock()
+	defer s.slotLocks[msg.Slot].Unlock()
+
+	if keyed, ok := currentSlot.(slots.Keyed); ok && (msg.Command == 'r' || msg.Command == 'g') {
+		// Users without permission cannot create keys
+		if !currentSlot.CanRead(&conn.LoggedUser) {
+			res := errs.Error("READ_PERMISSION")
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+
+		var err error
+		currentSlot, msg, err = keyedSlot(keyed, msg)
+		if err != nil {
+			slog.Debug("Error selecting key of slot",
+				slog.Int("slot", msg.Slot),
+				slog.Any("error", err),
+				slog.String("id", conn.ID),
+			)
+			res := errs.Error("WRONG_FORMAT")
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+	}
+
 	if msg.Command == 'w' {
 		return processWrite(conn, currentSlot, msg)
 	}
@@ -110,14 +208,253 @@ func (s *Server) HandleMessage(size int, data []byte, conn *connectionmanager.Co
 	if msg.Command == 'r' {
 		return processRead(conn, currentSlot, msg)
 	}
+
+	if msg.Command == 'c' {
+		return processCompareAndSwap(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'b' {
+		return processAcquire(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'g' {
+		return processTake(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 't' {
+		return processWriteWithTTL(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'i' {
+		return processInfo(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'z' {
+		return processReset(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'f' || msg.Command == 'h' {
+		return processOwnership(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 'o' {
+		return processCollection(conn, currentSlot, msg)
+	}
+
+	if msg.Command == 's' || msg.Command == 'd' {
+		return s.processSubscription(conn, currentSlot, msg)
+	}
 	return nil
 }
 
+// processSubscription subscribes the connection to the async events of the
+// slot or unsubscribes it. Only users that can read the slot can subscribe,
+// and events are only delivered while the user can read it.
+// On slots with history the subscription can carry the sequence number of
+// the last event received, the events after it are sent before replying
+// with the sequence number of the last event of the slot.
+func (s *Server) processSubscription(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if msg.Command == 'd' {
+		s.connections.Unsubscribe(slotID, conn.ID)
+		s.watches.remove(msg.Slot, conn.ID)
+		return sendSlotData(msg, conn, "")
+	}
+
+	if isCondition(msg.Value) {
+		return s.processWatch(conn, currentSlot, msg)
+	}
+
+	replayer, ok := currentSlot.(slots.Replayer)
+	hasHistory := ok && replayer.HasHistory()
+	if msg.Value != "" && !hasHistory {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	var after uint64
+	if msg.Value != "" {
+		var err error
+		after, err = strconv.ParseUint(msg.Value, 10, 64)
+		if err != nil {
+			res := errs.Error("WRONG_FORMAT")
+			return conn.SendEvent(res.Response(slotID))
+		}
+	}
+
+	if !currentSlot.CanRead(&conn.LoggedUser) {
+		slog.Info("Connection trying to subscribe to slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	// The missed events are replayed while subscribing, so the events
+	// broadcasted meanwhile are neither lost nor sent twice
+	var err error
+	if msg.Value != "" {
+		err = s.connections.SubscribeAfter(slotID, conn.ID, conn.LoggedUser, after, func() []string {
+			return replayer.Replay(after)
+		})
+	} else {
+		err = s.connections.Subscribe(slotID, conn.ID, conn.LoggedUser)
+	}
+	if err != nil {
+		slog.Debug("Error subscribing to slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+			slog.String("id", conn.ID),
+		)
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	slog.Debug("Connection subscribed to slot",
+		slog.Int("slot", msg.Slot),
+		slog.String("id", conn.ID),
+	)
+
+	if !hasHistory {
+		return sendSlotData(msg, conn, "")
+	}
+
+	return sendSlotData(msg, conn, strconv.FormatUint(replayer.Sequence(), 10))
+}
+
+// processWatch waits for a condition on the value of the slot, the
+// connection receives an async event with the value when the slot changes
+// and the condition holds. The condition is also checked when the watch is
+// set, so a client does not miss a value written before watching.
+func (s *Server) processWatch(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	versioned, ok := currentSlot.(slots.Versioned)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	cond, repeat, err := parseCondition(msg.Value)
+	if err != nil {
+		slog.Debug("Invalid watch condition received: "+err.Error(),
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+		)
+		res := errs.Error("WRONG_FORMAT")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	if !currentSlot.CanRead(&conn.LoggedUser) {
+		slog.Info("Connection trying to watch slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	// The response is sent before setting the watch, so the events always
+	// arrive after it
+	if err := sendSlotData(msg, conn, ""); err != nil {
+		return err
+	}
+
+	done, follow := s.watches.add(msg.Slot, watch{id: conn.ID, user: conn.LoggedUser, cond: cond, repeat: repeat})
+	if follow {
+		go s.followWatches(msg.Slot, versioned, done)
+	}
+
+	_, value, _ := versioned.Since(math.MaxUint64)
+	if len(s.watches.matching(msg.Slot, value, conn.ID)) > 0 {
+		return conn.SendEvent(watchEvent(slotID, value))
+	}
+	return nil
+}
+
+// followWatches checks the watches of the slot every time its version
+// changes, whatever changed it: a command, an expiration or a handover. It
+// runs until the last watch of the slot is removed.
+func (s *Server) followWatches(slot int, versioned slots.Versioned, done <-chan struct{}) {
+	var version uint64
+	for {
+		number, value, changed := versioned.Since(version)
+		if changed == nil {
+			version = number
+			s.checkWatches(slot, value)
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkWatches sends an async event to the connections watching the slot
+// whose condition holds for the value, the events are sent at the same time
+// without holding any lock. Connections that cannot receive the event lose
+// their watch.
+func (s *Server) checkWatches(slot int, value string) {
+	currentSlot := s.slotsArray[slot]
+	slotID := fmt.Sprintf("%03d", slot)
+
+	var wg sync.WaitGroup
+	for _, w := range s.watches.matching(slot, value, "") {
+		if !currentSlot.CanRead(&w.user) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.connections.Send(w.id, watchEvent(slotID, value))
+			if err != nil {
+				slog.Debug("Removing watch of connection",
+					slog.Int("slot", slot),
+					slog.String("id", w.id),
+					slog.Any("error", err),
+				)
+				s.watches.remove(slot, w.id)
+			}
+		}()
+	}
+
+	// The next change is checked after sending the events, so the events of
+	// a connection arrive in order
+	wg.Wait()
+}
+
+// history returns the events of the slot after the last event ID received by
+// a client and whether the events of the slot are numbered. An empty or
+// invalid ID does not replay any event.
+func (s *Server) history(slot int, lastEventID string) ([]string, bool) {
+	replayer, ok := s.slotsArray[slot].(slots.Replayer)
+	if !ok || !replayer.HasHistory() {
+		return nil, false
+	}
+
+	after, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return nil, true
+	}
+
+	return replayer.Replay(after), true
+}
+
 func processRead(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
 	if currentSlot.CanRead(&conn.LoggedUser) {
-		value := currentSlot.Read()
-		err := sendSlotData(msg, conn, value)
-		return err
+		value, err := readValue(currentSlot)
+		if err != nil {
+			res := errs.Error("SEQUENCE_EXHAUSTED")
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+		return sendSlotData(msg, conn, value)
 	}
 	slog.Error("Connection trying to read on slot without permission",
 		slog.Int("slot", msg.Slot),
@@ -129,6 +466,16 @@ func processRead(conn *connectionmanager.Connection, currentSlot slots.Slot, msg
 	return err
 }
 
+// readValue reads the slot, slots that hand out values return an error when
+// they run out of them.
+func readValue(currentSlot slots.Slot) (string, error) {
+	if issuer, ok := currentSlot.(slots.Issuer); ok {
+		return issuer.Next()
+	}
+
+	return currentSlot.Read(), nil
+}
+
 func processWrite(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
 	if !currentSlot.CanWrite(&conn.LoggedUser) {
 		slog.Info("Connection trying to write on slot without permission",
@@ -144,7 +491,7 @@ func processWrite(conn *connectionmanager.Connection, currentSlot slots.Slot, ms
 		return nil
 	}
 
-	value, err := currentSlot.Write(msg.Value, conn.NetworkConn)
+	value, err := slots.WriteAs(currentSlot, msg.Value, callerOf(conn))
 
 	if err != nil {
 		res := errs.Error("WRITE_FAILED")
@@ -165,13 +512,812 @@ func processWrite(conn *connectionmanager.Connection, currentSlot slots.Slot, ms
 	return err
 }
 
-func sendSlotData(msg Message, conn *connectionmanager.Connection, value string) error {
+// processAcknowledgedWrite writes a slot whose events must be acknowledged
+// with the w or t commands, the response is a framed response with the
+// connections that acknowledged the event.
+func processAcknowledgedWrite(conn *connectionmanager.Connection, currentSlot slots.Slot, acknowledger slots.Acknowledger, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if name, ok := checkPermission(currentSlot, msg, &conn.LoggedUser); !ok {
+		slog.Info("Connection trying to write on slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error(name)
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	var acked []string
+	var err error
+	if msg.Command == 't' {
+		ttlString, data, found := strings.Cut(msg.Value, "|")
+		ttl, convErr := strconv.Atoi(ttlString)
+		if !found || convErr != nil || ttl < 0 {
+			res := errs.Error("WRONG_FORMAT")
+			return conn.SendEvent(res.Response(slotID))
+		}
+		acked, err = acknowledger.WriteAcknowledgedWithTTL(data, time.Duration(ttl)*time.Second)
+	} else {
+		acked, err = acknowledger.WriteAcknowledged(msg.Value)
+	}
+	if err != nil {
+		res := errs.Error("WRITE_FAILED")
+		slog.Error("Error writing in slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+		)
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	lines := make([]string, 0, len(acked))
+	for _, id := range acked {
+		lines = append(lines, slotData(msg.Slot, id))
+	}
+
+	return sendFramedData(conn, slotID, lines)
+}
+
+// processAck acknowledges the event of a reliable slot with the sequence
+// number of the message.
+func processAck(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	acknowledger, ok := currentSlot.(slots.Acknowledger)
+	if !ok || !acknowledger.IsReliable() {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	if !currentSlot.CanRead(&conn.LoggedUser) {
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	seq, err := strconv.ParseUint(msg.Value, 10, 64)
+	if err != nil {
+		res := errs.Error("WRONG_FORMAT")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	acknowledger.Ack(seq, conn.ID)
+	return sendSlotData(msg, conn, msg.Value)
+}
+
+// processBlockingRead returns the value of the slot as soon as its version
+// is newer than the one sent by the client, waiting for the next change up
+// to the timeout. The value is "<version>[|<timeout>]", without version the
+// current value is returned immediately. The response is the version and
+// the value separated by a pipe, when the timeout passes the current version
+// and value are returned. A TCP connection does not run other commands while
+// it waits, they are run after the response, and it stops waiting when the
+// client hangs up.
+func processBlockingRead(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	versioned, ok := currentSlot.(slots.Versioned)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	if !currentSlot.CanRead(&conn.LoggedUser) {
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	version, wait, err := parseBlockingRead(msg.Value)
+	if err != nil {
+		res := errs.Error("WRONG_FORMAT")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var hangup <-chan struct{}
+	for {
+		number, value, changed := versioned.Since(version)
+		if changed == nil {
+			return sendSlotData(msg, conn, strconv.FormatUint(number, 10)+"|"+value)
+		}
+
+		// The connection does not read other commands while waiting, so
+		// it is watched to stop waiting when the client hangs up
+		if hangup == nil {
+			var stop func()
+			hangup, stop = conn.Hangup()
+			defer stop()
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return sendSlotData(msg, conn, strconv.FormatUint(number, 10)+"|"+value)
+		case <-conn.Quit:
+			return errs.PermanentError{Err: "Connection closed"}
+		case <-hangup:
+			slog.Debug("Client disconnected while waiting",
+				slog.Int("slot", msg.Slot),
+				slog.String("id", conn.ID),
+			)
+			return errs.PermanentError{Err: "Connection closed"}
+		}
+	}
+}
+
+// parseBlockingRead parses the version and the timeout in seconds of a
+// blocking read, without version the read does not wait.
+func parseBlockingRead(value string) (uint64, time.Duration, error) {
+	versionValue, waitValue, hasWait := strings.Cut(value, "|")
+
+	wait := defaultReadWait
+	if hasWait {
+		seconds, err := strconv.Atoi(waitValue)
+		if err != nil || seconds < 0 {
+			return 0, 0, errors.New("invalid timeout")
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxReadWait)
+	}
+
+	if versionValue == "" {
+		return 0, 0, nil
+	}
+
+	version, err := strconv.ParseUint(versionValue, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid version")
+	}
+	return version, wait, nil
+}
+
+// processMultiRead reads a list or range of slots and returns all the values
+// in a single framed response. Every slot is read independently, slots that
+// are missing or cannot be read by the user return an error line.
+func (s *Server) processMultiRead(conn *connectionmanager.Connection, msg Message) error {
+	slotIDs, err := parseSlotList(msg.Value)
+	if err != nil {
+		slog.Debug("Invalid slot list received: "+err.Error(),
+			slog.String("list", msg.Value),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("WRONG_FORMAT")
+		return conn.SendEvent(res.Response("xxx"))
+	}
+
+	lines := make([]string, 0, len(slotIDs))
+	for _, id := range slotIDs {
+		lines = append(lines, s.readSlot(id, &conn.LoggedUser))
+	}
+
+	return sendFramedData(conn, "xxx", lines)
+}
+
+// readSlot reads a single slot on behalf of the user and returns the response line.
+func (s *Server) readSlot(id int, user *auth.User) string {
+	currentSlot := s.slotsArray[id]
+	if currentSlot == nil {
+		res := errs.Error("MISSING_SLOT")
+		return res.Response(fmt.Sprintf("%03d", id))
+	}
+
+	if !currentSlot.CanRead(user) {
+		res := errs.Error("READ_PERMISSION")
+		return res.Response(fmt.Sprintf("%03d", id))
+	}
+
+	s.slotLocks[id].Lock()
+	defer s.slotLocks[id].Unlock()
+
+	value, err := readValue(currentSlot)
+	if err != nil {
+		res := errs.Error("SEQUENCE_EXHAUSTED")
+		return res.Response(fmt.Sprintf("%03d", id))
+	}
+	return slotData(id, value)
+}
+
+// processInfo describes the kind, configuration and live state of the slot,
+// along with the permissions of the user on it. Any user that can read or
+// write the slot can request its information.
+func processInfo(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	canRead := currentSlot.CanRead(&conn.LoggedUser)
+	canWrite := currentSlot.CanWrite(&conn.LoggedUser)
+	if !canRead && !canWrite {
+		slog.Info("Connection trying to get information of slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	inspector, ok := currentSlot.(slots.Inspector)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	permissions := ""
+	if canRead {
+		permissions += "r"
+	}
+	if canWrite {
+		permissions += "w"
+	}
+
+	info := inspector.Info()
+	lines := make([]string, 0, len(info)+1)
+	for _, entry := range info {
+		lines = append(lines, slotData(msg.Slot, entry))
+	}
+	lines = append(lines, slotData(msg.Slot, "permissions="+permissions))
+
+	return sendFramedData(conn, slotID, lines)
+}
+
+// processOwnership releases or renews the ownership of a slot, the client
+// must be the current owner.
+func processOwnership(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if !currentSlot.CanWrite(&conn.LoggedUser) {
+		slog.Info("Connection trying to change ownership of slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("WRITE_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	owned, ok := currentSlot.(slots.Owned)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	var value string
+	var err error
+	if msg.Command == 'f' {
+		value, err = owned.Release(callerOf(conn))
+	} else {
+		value, err = owned.Renew(callerOf(conn))
+	}
+
+	if err != nil {
+		slog.Debug("Error changing ownership of slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+			slog.String("id", conn.ID),
+		)
+		res := errs.Error("NOT_OWNER")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	return sendSlotData(msg, conn, value)
+}
+
+// callerOf identifies the client of the connection for slots that have owners.
+func callerOf(conn *connectionmanager.Connection) slots.Caller {
+	caller := slots.Caller{ID: conn.ID, Conn: conn.NetworkConn, Session: conn.Session}
+	if conn.IsLogged {
+		caller.User = conn.LoggedUser.Name
+	}
+
+	return caller
+}
+
+// processReset takes the slot back to its initial state, it can only be
+// executed by admin users.
+func processReset(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if !conn.LoggedUser.Admin {
+		slog.Warn("Connection trying to reset slot without admin permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("user", conn.LoggedUser.Name),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("ADMIN_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	resetter, ok := currentSlot.(slots.Resetter)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	value := resetter.Reset()
+	slog.Info("Slot reset by admin",
+		slog.Int("slot", msg.Slot),
+		slog.String("user", conn.LoggedUser.Name),
+		slog.String("id", conn.ID),
+	)
+	return sendSlotData(msg, conn, value)
+}
+
+func processCompareAndSwap(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	if name, ok := checkPermission(currentSlot, msg, &conn.LoggedUser); !ok {
+		slog.Info("Connection trying to compare and swap on slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error(name)
+		return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+	}
+
+	response, _ := compareAndSwap(currentSlot, msg, callerOf(conn))
+	return conn.SendEvent(response)
+}
+
+// processCollection runs an operation on a slot that holds many entries, the
+// value of the message contains the operation and its argument separated by
+// a pipe. Entries are listed in pages, the argument of the list operation is
+// the last entry of the previous page. Slots with members can also add them
+// and check if they belong to the slot.
+func processCollection(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	collection, ok := currentSlot.(slots.Collection)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	operation, entry, _ := strings.Cut(msg.Value, "|")
+	if name, ok := collectionPermission(currentSlot, operation, &conn.LoggedUser); !ok {
+		slog.Info("Connection trying to run an operation on slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("operation", operation),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error(name)
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	membership, hasMembers := currentSlot.(slots.Membership)
+	switch {
+	case (operation == "add" || operation == "has") && !hasMembers:
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	case operation == "add" && entry != "":
+		added, err := membership.Add(entry)
+		if err != nil {
+			slog.Debug("Error adding member to slot",
+				slog.Int("slot", msg.Slot),
+				slog.Any("error", err),
+				slog.String("id", conn.ID),
+			)
+			res := errs.Error("WRITE_FAILED")
+			return conn.SendEvent(res.Response(slotID))
+		}
+		return sendSlotData(msg, conn, strconv.FormatBool(added))
+	case operation == "has" && entry != "":
+		return sendSlotData(msg, conn, strconv.FormatBool(membership.Has(entry)))
+	case operation == "del" && entry != "":
+		return sendSlotData(msg, conn, strconv.FormatBool(collection.Remove(entry)))
+	case operation == "size":
+		return sendSlotData(msg, conn, strconv.Itoa(collection.Size()))
+	case operation == "list":
+		entries := collection.List(entry, listPageSize)
+		lines := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			lines = append(lines, slotData(msg.Slot, entry))
+		}
+		return sendFramedData(conn, slotID, lines)
+	default:
+		res := errs.Error("WRONG_FORMAT")
+		return conn.SendEvent(res.Response(slotID))
+	}
+}
+
+// collectionPermission verifies that the user can run the operation on the
+// slot, if it cannot, it returns the name of the error to send.
+func collectionPermission(currentSlot slots.Slot, operation string, user *auth.User) (string, bool) {
+	if operation == "add" || operation == "del" {
+		if !currentSlot.CanWrite(user) {
+			return "WRITE_PERMISSION", false
+		}
+		return "", true
+	}
+
+	if !currentSlot.CanRead(user) {
+		return "READ_PERMISSION", false
+	}
+	return "", true
+}
+
+// keyedSlot selects the slot of the key in the value of the message, the
+// key is followed by the value of the command separated by a pipe.
+func keyedSlot(keyed slots.Keyed, msg Message) (slots.Slot, Message, error) {
+	key, value, _ := strings.Cut(msg.Value, "|")
+	slot, err := keyed.Key(key)
+	if err != nil {
+		return nil, msg, err
+	}
+
+	msg.Value = value
+	return slot, msg, nil
+}
+
+// processAcquire writes the slot when it is available or puts the client in
+// line to own it. A queued client receives the number of clients in line up
+// to its position and an async event when the slot is handed over to it.
+func processAcquire(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if !currentSlot.CanWrite(&conn.LoggedUser) {
+		slog.Info("Connection trying to acquire slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("WRITE_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	waiter, ok := currentSlot.(slots.Waiter)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	value, position, err := waiter.Acquire(msg.Value, callerOf(conn))
+	if err != nil {
+		slog.Debug("Error acquiring slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+			slog.String("id", conn.ID),
+		)
+		res := errs.Error("WRITE_FAILED")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	if position > 0 {
+		return conn.SendEvent("v" + slotID + strconv.Itoa(position) + "\n")
+	}
+
+	return sendSlotData(msg, conn, value)
+}
+
+// processTake takes the number of tokens in the value of the message from
+// the slot, a negative number returns the tokens to the slot. The response
+// contains the number of tokens taken or returned.
+func processTake(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+	if !currentSlot.CanRead(&conn.LoggedUser) {
+		slog.Info("Connection trying to take tokens from slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error("READ_PERMISSION")
+		return conn.SendEvent(res.Response(slotID))
+	}
+
+	response, _ := takeTokens(currentSlot, msg, callerOf(conn))
+	return conn.SendEvent(response)
+}
+
+// takeTokens takes or refunds the tokens in the value of the message, only
+// the tokens taken by the caller can be refunded. It returns the response
+// line and whether the tokens were taken or refunded.
+func takeTokens(currentSlot slots.Slot, msg Message, caller slots.Caller) (string, bool) {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+
+	taker, ok := currentSlot.(slots.Taker)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return res.Response(slotID), false
+	}
+
+	tokens, err := strconv.Atoi(msg.Value)
+	if err != nil || tokens == 0 {
+		res := errs.Error("WRONG_FORMAT")
+		return res.Response(slotID), false
+	}
+
+	var value int
+	if tokens > 0 {
+		value, err = taker.Take(tokens, caller)
+	} else {
+		value, err = taker.Refund(-tokens, caller)
+	}
+
+	if err == slots.ErrNotTaken {
+		res := errs.Error("NOT_TAKEN")
+		return res.Response(slotID), false
+	}
+
+	if err != nil && err != slots.ErrNotEnoughTokens {
+		res := errs.Error("WRONG_FORMAT")
+		return res.Response(slotID), false
+	}
+
+	return slotData(msg.Slot, strconv.Itoa(value)), err == nil
+}
+
+// compareAndSwap executes a compare and swap command, the value of the message
+// contains the expected value and the new value separated by a pipe.
+// It returns the response line and whether the value was written.
+func compareAndSwap(currentSlot slots.Slot, msg Message, caller slots.Caller) (string, bool) {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+
+	swapper, ok := currentSlot.(slots.Swapper)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return res.Response(slotID), false
+	}
+
+	expected, data, found := strings.Cut(msg.Value, "|")
+	if !found {
+		res := errs.Error("WRONG_FORMAT")
+		return res.Response(slotID), false
+	}
+
+	value, err := swapper.CompareAndSwap(expected, data, caller)
+	if errors.Is(err, slots.ErrValueMismatch) {
+		res := errs.Error("COMPARE_FAILED")
+		return res.Response(slotID), false
+	}
+
+	if err != nil {
+		slog.Error("Error on compare and swap in slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+		)
+		res := errs.Error("WRITE_FAILED")
+		return res.Response(slotID), false
+	}
+
+	return slotData(msg.Slot, value), true
+}
+
+func processWriteWithTTL(conn *connectionmanager.Connection, currentSlot slots.Slot, msg Message) error {
+	if name, ok := checkPermission(currentSlot, msg, &conn.LoggedUser); !ok {
+		slog.Info("Connection trying to write on slot without permission",
+			slog.Int("slot", msg.Slot),
+			slog.String("id", conn.ID),
+			slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+		)
+		res := errs.Error(name)
+		return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+	}
+
+	response, _ := writeWithTTL(currentSlot, msg, conn.NetworkConn)
+	return conn.SendEvent(response)
+}
+
+// writeWithTTL executes a write that expires, the value of the message contains
+// the ttl in seconds and the value to write separated by a pipe.
+// It returns the response line and whether the value was written.
+func writeWithTTL(currentSlot slots.Slot, msg Message, from net.Conn) (string, bool) {
+	slotID := fmt.Sprintf("%03d", msg.Slot)
+
+	expirer, ok := currentSlot.(slots.Expirer)
+	if !ok {
+		res := errs.Error("NOT_SUPPORTED")
+		return res.Response(slotID), false
+	}
+
+	ttlString, data, found := strings.Cut(msg.Value, "|")
+	ttl, err := strconv.Atoi(ttlString)
+	if !found || err != nil || ttl < 0 {
+		res := errs.Error("WRONG_FORMAT")
+		return res.Response(slotID), false
+	}
+
+	value, err := expirer.WriteWithTTL(data, time.Duration(ttl)*time.Second, from)
+	if err != nil {
+		slog.Error("Error writing in slot",
+			slog.Int("slot", msg.Slot),
+			slog.Any("error", err),
+		)
+		res := errs.Error("WRITE_FAILED")
+		return res.Response(slotID), false
+	}
+
+	return slotData(msg.Slot, value), true
+}
+
+// checkPermission verifies that the user can execute the command on the slot,
+// if it cannot, it returns the name of the error to send.
+func checkPermission(currentSlot slots.Slot, msg Message, user *auth.User) (string, bool) {
+	needsRead := msg.Command == 'r' || msg.Command == 'c' || msg.Command == 'g'
+	if needsRead && !currentSlot.CanRead(user) {
+		return "READ_PERMISSION", false
+	}
+
+	needsWrite := msg.Command == 'w' || msg.Command == 'c' || msg.Command == 't'
+	if needsWrite && !currentSlot.CanWrite(user) {
+		return "WRITE_PERMISSION", false
+	}
+
+	return "", true
+}
+
+func processBatchStart(conn *connectionmanager.Connection) error {
+	if conn.InBatch {
+		res := errs.Error("BATCH_ERROR")
+		return conn.SendEvent(res.Response("xxx"))
+	}
+
+	conn.InBatch = true
+	conn.Batch = nil
+	return conn.SendEvent("vxxx0\n")
+}
+
+func queueBatchCommand(conn *connectionmanager.Connection, msg Message) error {
+	if msg.Command != 'r' && msg.Command != 'w' && msg.Command != 'c' && msg.Command != 't' && msg.Command != 'g' {
+		res := errs.Error("BATCH_ERROR")
+		return conn.SendEvent(res.Response("xxx"))
+	}
+
+	if len(conn.Batch) >= maxBatchSize {
+		res := errs.Error("BATCH_ERROR")
+		return conn.SendEvent(res.Response("xxx"))
+	}
+
+	conn.Batch = append(conn.Batch, msg.Raw)
+	return conn.SendEvent("vxxx" + strconv.Itoa(len(conn.Batch)) + "\n")
+}
+
+// processBatch executes all the queued commands of the connection while holding
+// the locks of every slot involved, so no other command can be executed on
+// those slots in the middle of the batch.
+// Permissions are verified before running anything, if any command fails the
+// rest of the batch is not executed and the commands executed before it are
+// rolled back. Only slots whose changes can be undone can be used in batches.
+func (s *Server) processBatch(conn *connectionmanager.Connection) error {
+	if !conn.InBatch {
+		res := errs.Error("BATCH_ERROR")
+		return conn.SendEvent(res.Response("xxx"))
+	}
+
+	queued := conn.Batch
+	conn.InBatch = false
+	conn.Batch = nil
+
+	msgs := make([]Message, 0, len(queued))
+	slotIDs := make([]int, 0, len(queued))
+	for _, raw := range queued {
+		msg, err := ParseMessage(len(raw), []byte(raw))
+		if err != nil {
+			res := errs.Error("PARSE_ERROR")
+			return conn.SendEvent(res.Response("xxx"))
+		}
+
+		currentSlot := s.slotsArray[msg.Slot]
+		if currentSlot == nil {
+			res := errs.Error("MISSING_SLOT")
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+
+		if _, ok := currentSlot.(slots.Restorer); !ok {
+			res := errs.Error("BATCH_ERROR")
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+
+		if name, ok := checkPermission(currentSlot, msg, &conn.LoggedUser); !ok {
+			slog.Info("Connection trying to run a batch on slot without permission",
+				slog.Int("slot", msg.Slot),
+				slog.String("id", conn.ID),
+				slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+			)
+			res := errs.Error(name)
+			return conn.SendEvent(res.Response(fmt.Sprintf("%03d", msg.Slot)))
+		}
+
+		msgs = append(msgs, msg)
+		slotIDs = append(slotIDs, msg.Slot)
+	}
+
+	// Locks are always taken in the same order to avoid deadlocks between batches
+	slices.Sort(slotIDs)
+	slotIDs = slices.Compact(slotIDs)
+	// The changes are held until the batch ends, so the clients waiting for
+	// changes never see the changes that are rolled back
+	ends := make([]func(bool), 0, len(slotIDs))
+	for _, id := range slotIDs {
+		s.slotLocks[id].Lock()
+		ends = append(ends, s.slotsArray[id].(slots.Restorer).Save())
+	}
+
+	committed := true
+	lines := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		line, ok := runCommand(s.slotsArray[msg.Slot], msg, callerOf(conn))
+		lines = append(lines, line)
+		if !ok {
+			committed = false
+			break
+		}
+	}
+
+	for _, end := range ends {
+		end(committed)
+	}
+
+	for _, id := range slotIDs {
+		s.slotLocks[id].Unlock()
+	}
+
+	slog.Debug("Batch executed",
+		slog.Int("commands", len(msgs)),
+		slog.Int("executed", len(lines)),
+		slog.String("id", conn.ID),
+		slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+	)
+	return sendFramedData(conn, "xxx", lines)
+}
+
+// runCommand executes a read, write, compare and swap, expiring write or take command on
+// the slot and returns the response line and whether the command succeeded. Reads denied
+// by a limiter fail with the usual response of the limiter.
+func runCommand(currentSlot slots.Slot, msg Message, caller slots.Caller) (string, bool) {
+	switch msg.Command {
+	case 'r':
+		if limiter, ok := currentSlot.(slots.Limiter); ok {
+			value, allowed := limiter.Allow()
+			return slotData(msg.Slot, value), allowed
+		}
+
+		value, err := readValue(currentSlot)
+		if err != nil {
+			res := errs.Error("SEQUENCE_EXHAUSTED")
+			return res.Response(fmt.Sprintf("%03d", msg.Slot)), false
+		}
+		return slotData(msg.Slot, value), true
+	case 'w':
+		value, err := slots.WriteAs(currentSlot, msg.Value, caller)
+		if err != nil {
+			slog.Error("Error writing in slot",
+				slog.Int("slot", msg.Slot),
+				slog.Any("error", err),
+			)
+			res := errs.Error("WRITE_FAILED")
+			return res.Response(fmt.Sprintf("%03d", msg.Slot)), false
+		}
+		return slotData(msg.Slot, value), true
+	case 'c':
+		return compareAndSwap(currentSlot, msg, caller)
+	case 't':
+		return writeWithTTL(currentSlot, msg, caller.Conn)
+	case 'g':
+		return takeTokens(currentSlot, msg, caller)
+	default:
+		res := errs.Error("BATCH_ERROR")
+		return res.Response(fmt.Sprintf("%03d", msg.Slot)), false
+	}
+}
+
+// sendFramedData sends several response lines as a single response, the lines
+// are preceded by a header with the slot and the number of lines that follow.
+func sendFramedData(conn *connectionmanager.Connection, slot string, lines []string) error {
+	var sb strings.Builder
+	sb.WriteString("l")
+	sb.WriteString(slot)
+	sb.WriteString(strconv.Itoa(len(lines)))
+	sb.WriteString("\n")
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+
+	return conn.SendEvent(sb.String())
+}
+
+func slotData(slot int, value string) string {
 	var sb strings.Builder
 	sb.WriteString("v")
-	fmt.Fprintf(&sb, "%03d", msg.Slot)
+	fmt.Fprintf(&sb, "%03d", slot)
 	sb.WriteString(value)
 	sb.WriteString("\n")
-	err := conn.SendEvent(sb.String())
+	return sb.String()
+}
+
+func sendSlotData(msg Message, conn *connectionmanager.Connection, value string) error {
+	err := conn.SendEvent(slotData(msg.Slot, value))
 	if err != nil {
 		return err
 	}
@@ -184,7 +1330,7 @@ func sendSlotData(msg Message, conn *connectionmanager.Connection, value string)
 	return nil
 }
 
-func processUsername(conn *connectionmanager.Connection, msg Message) error {
+func processUsername(s *Server, conn *connectionmanager.Connection, msg Message) error {
 	err := auth.ValidateUsername(msg.Value)
 	if err != nil {
 		res := errs.Error("WRONG_USER")
@@ -200,6 +1346,9 @@ func processUsername(conn *connectionmanager.Connection, msg Message) error {
 	conn.LoggedUser = auth.User{}
 	conn.Username = msg.Value
 	conn.IsLogged = false
+	// The subscriptions were authorized for the previous user
+	s.connections.UnsubscribeAll(conn.ID)
+	s.watches.removeAll(conn.ID)
 
 	var sb strings.Builder
 	sb.WriteString("v")
@@ -217,6 +1366,27 @@ func processUsername(conn *connectionmanager.Connection, msg Message) error {
 	return nil
 }
 
+// processSession sets the session token of the connection, slots owned by
+// session identify their owner with this token so the client can keep the
+// ownership after reconnecting.
+func processSession(conn *connectionmanager.Connection, msg Message) error {
+	conn.Session = msg.Value
+
+	var sb strings.Builder
+	sb.WriteString("v")
+	sb.WriteString(conn.Session)
+	sb.WriteString("\n")
+	err := conn.SendEvent(sb.String())
+	if err != nil {
+		return err
+	}
+	slog.Debug("Session set for connection",
+		slog.String("id", conn.ID),
+		slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()),
+	)
+	return nil
+}
+
 func processPassword(s *Server, conn *connectionmanager.Connection, msg Message) error {
 	user, err := auth.GetUser(conn.Username, msg.Value)
 	if err != nil {
@@ -242,8 +1412,10 @@ func processPassword(s *Server, conn *connectionmanager.Connection, msg Message)
 		slog.Debug("Disconnecting", slog.String("remote_addr", conn.NetworkConn.RemoteAddr().String()))
 		return errs.PermanentError{Err: "Invalid login"}
 	}
-	conn.LoggedUser = user
+	conn.LoggedUser = s.usersMap[user.Name]
 	conn.IsLogged = true
+	s.connections.UnsubscribeAll(conn.ID)
+	s.watches.removeAll(conn.ID)
 
 	var sb strings.Builder
 	sb.WriteString("v")
@@ -47,10 +47,59 @@ func generateConfig(port string) *config.Config {
 	viper.Set("slot_004.users.sammy", "a")
 	slotFour, _ := slots.GetSlot(viper.Sub("slot_004"), c.Connections, "004")
 	c.Slots[4] = slotFour
+	viper.Set("slot_005.kind", "timeout_memory")
+	viper.Set("slot_005.timeout", 60)
+	viper.Set("slot_005.owner_mode", "session")
+	slotFive, _ := slots.GetSlot(viper.Sub("slot_005"), c.Connections, "005")
+	c.Slots[5] = slotFive
+	viper.Set("slot_006.kind", "token_bucket")
+	viper.Set("slot_006.bucket_size", 10)
+	viper.Set("slot_006.refresh_rate", 10)
+	viper.Set("slot_006.period", "1h")
+	slotSix, _ := slots.GetSlot(viper.Sub("slot_006"), c.Connections, "006")
+	c.Slots[6] = slotSix
+	viper.Set("slot_007.kind", "token_bucket")
+	viper.Set("slot_007.bucket_size", 2)
+	viper.Set("slot_007.refresh_rate", 2)
+	viper.Set("slot_007.period", "hour")
+	viper.Set("slot_007.keyed", true)
+	slotSeven, _ := slots.GetSlot(viper.Sub("slot_007"), c.Connections, "007")
+	c.Slots[7] = slotSeven
+	viper.Set("slot_008.kind", "broadcast")
+	viper.Set("slot_008.users.pepe", "r")
+	viper.Set("slot_008.users.sammy", "a")
+	slotEight, _ := slots.GetSlot(viper.Sub("slot_008"), c.Connections, "008")
+	c.Slots[8] = slotEight
+	viper.Set("slot_009.kind", "broadcast")
+	viper.Set("slot_009.history", 3)
+	slotNine, _ := slots.GetSlot(viper.Sub("slot_009"), c.Connections, "009")
+	c.Slots[9] = slotNine
+	viper.Set("slot_010.kind", "broadcast")
+	viper.Set("slot_010.reliable", true)
+	viper.Set("slot_010.ack_timeout", 1000)
+	slotTen, _ := slots.GetSlot(viper.Sub("slot_010"), c.Connections, "010")
+	c.Slots[10] = slotTen
+	viper.Set("slot_011.kind", "atomic")
+	slotEleven, _ := slots.GetSlot(viper.Sub("slot_011"), c.Connections, "011")
+	c.Slots[11] = slotEleven
+	viper.Set("slot_012.kind", "map")
+	slotTwelve, _ := slots.GetSlot(viper.Sub("slot_012"), c.Connections, "012")
+	c.Slots[12] = slotTwelve
+	viper.Set("slot_013.kind", "set")
+	viper.Set("slot_013.users.pepe", "r")
+	viper.Set("slot_013.users.sammy", "a")
+	slotThirteen, _ := slots.GetSlot(viper.Sub("slot_013"), c.Connections, "013")
+	c.Slots[13] = slotThirteen
+	viper.Set("slot_015.kind", "sequence")
+	viper.Set("slot_015.start", 1)
+	viper.Set("slot_015.max", 2)
+	slotFifteen, _ := slots.GetSlot(viper.Sub("slot_015"), c.Connections, "015")
+	c.Slots[15] = slotFifteen
 
 	viper.Set("users.pepe", "passw0rd")
 	viper.Set("users.bobby", "otherPassw0rd")
 	viper.Set("users.sammy", "samPassw0rd")
+	viper.Set("admins", []string{"sammy"})
 	c.LoadUsers()
 
 	return c
@@ -415,3 +464,1385 @@ func TestTelnetSupport(t *testing.T) {
 		t.Fatalf("unexpected server response: [%s]", response)
 	}
 }
+
+func sendFramed(t *testing.T, conn net.Conn, data string) []string {
+	if _, err := conn.Write([]byte(data)); err != nil {
+		t.Fatalf("couldn't send request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("couldn't read server response: %v", err)
+	}
+
+	if !strings.HasPrefix(header, "l") {
+		t.Fatalf("unexpected framed header: %s", header)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(header[4:]))
+	if err != nil {
+		t.Fatalf("invalid line count on header %s: %v", header, err)
+	}
+
+	lines := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("couldn't read framed line: %v", err)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// Tests for compare and swap
+
+func TestCompareAndSwap(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w000Hello\n")
+
+	response := sendData(t, conn, "c000Hello|World\n")
+	if response != "v000World\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "c000Hello|Again\n")
+	if response != "e000011\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r000\n")
+	if response != "v000World\n" {
+		t.Fatalf("value must not change after a failed compare: %s", response)
+	}
+}
+
+func TestCompareAndSwapWrongFormat(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "c000Hello\n")
+	if response != "e000009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+func TestCompareAndSwapPermission(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "upepe\n")
+	sendData(t, conn, "ppassw0rd\n")
+
+	response := sendData(t, conn, "c004|Something\n")
+	if response != "e004006\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for batches
+
+func TestBatch(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w001Ready\n")
+
+	response := sendData(t, conn, "m\n")
+	if response != "vxxx0\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "w000Busy\n")
+	if response != "vxxx1\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "c001Ready|Taken\n")
+	if response != "vxxx2\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	sendData(t, conn, "r002\n")
+
+	lines := sendFramed(t, conn, "x\n")
+	expected := []string{"v000Busy\n", "v001Taken\n", "v002\n"}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected number of lines: %v", lines)
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Fatalf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+}
+
+func TestBatchStopsOnFailedCompare(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w000Taken\n")
+	sendData(t, conn, "m\n")
+	sendData(t, conn, "c000Ready|Taken\n")
+	sendData(t, conn, "w001Busy\n")
+
+	lines := sendFramed(t, conn, "x\n")
+	if len(lines) != 1 || lines[0] != "e000011\n" {
+		t.Fatalf("unexpected batch response: %v", lines)
+	}
+
+	response := sendData(t, conn, "r001\n")
+	if response != "v001\n" {
+		t.Fatalf("write after a failed compare must not be executed: %s", response)
+	}
+}
+
+func TestBatchRollsBackOnDeniedLimiter(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	for range 10 {
+		sendData(t, conn, "r006\n")
+	}
+
+	sendData(t, conn, "m\n")
+	sendData(t, conn, "w000Flag\n")
+	sendData(t, conn, "r006\n")
+
+	lines := sendFramed(t, conn, "x\n")
+	if len(lines) != 2 || lines[0] != "v000Flag\n" || lines[1] != "v0060\n" {
+		t.Fatalf("unexpected batch response: %v", lines)
+	}
+
+	response := sendData(t, conn, "r000\n")
+	if response != "v000\n" {
+		t.Fatalf("writes before a denied limiter must be rolled back: %s", response)
+	}
+}
+
+func TestBatchRollbackDoesNotWakeReaders(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	reader, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer reader.Close()
+
+	for range 10 {
+		sendData(t, conn, "r006\n")
+	}
+
+	reader.Write([]byte("n0000|1\n"))
+	time.Sleep(100 * time.Millisecond)
+
+	sendData(t, conn, "m\n")
+	sendData(t, conn, "w000Flag\n")
+	sendData(t, conn, "r006\n")
+	sendFramed(t, conn, "x\n")
+
+	// The reader only returns when the wait times out, with the same version
+	reader.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil || response != "v0000|\n" {
+		t.Fatalf("a rolled back batch must not wake the reader: %s %v", response, err)
+	}
+}
+
+func TestBatchReturnsTakenTokens(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "m\n")
+	response := sendData(t, conn, "g00610\n")
+	if response != "vxxx1\n" {
+		t.Fatalf("takes must be queued in batches: %s", response)
+	}
+	sendData(t, conn, "c000Ready|Taken\n")
+
+	lines := sendFramed(t, conn, "x\n")
+	if len(lines) != 2 || lines[0] != "v00610\n" || lines[1] != "e000011\n" {
+		t.Fatalf("unexpected batch response: %v", lines)
+	}
+
+	response = sendData(t, conn, "g00610\n")
+	if response != "v00610\n" {
+		t.Fatalf("tokens taken by a failed batch must be returned: %s", response)
+	}
+}
+
+func TestBatchRejectedCommands(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "m\n")
+	response := sendData(t, conn, "l000-002\n")
+	if response != "exxx012\n" {
+		t.Fatalf("multi reads must not run inside a batch: %s", response)
+	}
+
+	response = sendData(t, conn, "ksession\n")
+	if response != "exxx012\n" {
+		t.Fatalf("sessions must not be set inside a batch: %s", response)
+	}
+
+	sendData(t, conn, "r995\n")
+	response = sendData(t, conn, "x\n")
+	if response != "e995012\n" {
+		t.Fatalf("slots that cannot be rolled back must not be used in batches: %s", response)
+	}
+}
+
+func TestBatchRejectsKeyedSlots(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "m\n")
+	sendData(t, conn, "w000Busy\n")
+	sendData(t, conn, "r007customer1\n")
+	response := sendData(t, conn, "x\n")
+	if response != "e007012\n" {
+		t.Fatalf("keyed slots must not be used in batches: %s", response)
+	}
+
+	response = sendData(t, conn, "r000\n")
+	if response != "v000\n" {
+		t.Fatalf("batch must not be executed with keyed slots: %s", response)
+	}
+
+	response = sendData(t, conn, "r007customer1\n")
+	if response != "v0071\n" {
+		t.Fatalf("no tokens must be taken from the key: %s", response)
+	}
+}
+
+func TestBatchPermission(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "m\n")
+	sendData(t, conn, "w000Busy\n")
+	sendData(t, conn, "r004\n")
+
+	response := sendData(t, conn, "x\n")
+	if response != "e004008\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r000\n")
+	if response != "v000\n" {
+		t.Fatalf("batch must not be executed without permissions: %s", response)
+	}
+}
+
+func TestBatchNotStarted(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "x\n")
+	if response != "exxx012\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for multi-read
+
+func TestMultiReadRange(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w000Hello\n")
+	sendData(t, conn, "w002World\n")
+
+	lines := sendFramed(t, conn, "l000-002\n")
+	expected := []string{"v000Hello\n", "v001\n", "v002World\n"}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected number of lines: %v", lines)
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Fatalf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+}
+
+func TestMultiReadList(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w000Hello\n")
+
+	lines := sendFramed(t, conn, "l000,004,123\n")
+	expected := []string{"v000Hello\n", "e004008\n", "e123005\n"}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected number of lines: %v", lines)
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Fatalf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+}
+
+func TestMultiReadInvalidRange(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "l010-002\n")
+	if response != "exxx009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "l000-1000\n")
+	if response != "exxx009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for slot information
+
+func TestInfo(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w003Owned\n")
+
+	lines := sendFramed(t, conn, "i003\n")
+	if len(lines) != 9 {
+		t.Fatalf("unexpected number of lines: %v", lines)
+	}
+
+	if lines[0] != "v003kind=timeout_memory\n" {
+		t.Fatalf("first line must be the kind: %s", lines[0])
+	}
+
+	if lines[1] != "v003timeout=60\n" {
+		t.Fatalf("unexpected timeout line: %s", lines[1])
+	}
+
+	if lines[2] != "v003owner_mode=connection\n" {
+		t.Fatalf("unexpected owner mode line: %s", lines[2])
+	}
+
+	if lines[3] != "v003owned=true\n" {
+		t.Fatalf("unexpected owned line: %s", lines[3])
+	}
+
+	if lines[8] != "v003permissions=rw\n" {
+		t.Fatalf("unexpected permissions line: %s", lines[8])
+	}
+}
+
+func TestInfoPermission(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "i004\n")
+	if response != "e004008\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	sendData(t, conn, "ubobby\n")
+	sendData(t, conn, "potherPassw0rd\n")
+
+	lines := sendFramed(t, conn, "i004\n")
+	if lines[len(lines)-1] != "v004permissions=w\n" {
+		t.Fatalf("unexpected permissions line: %v", lines)
+	}
+}
+
+// Tests for admin commands
+
+func TestResetSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w003Wedged\n")
+
+	connAdmin, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer connAdmin.Close()
+
+	sendData(t, connAdmin, "usammy\n")
+	sendData(t, connAdmin, "psamPassw0rd\n")
+
+	response := sendData(t, connAdmin, "z003\n")
+	if response != "v003\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	// The slot is released so the admin can take it over
+	response = sendData(t, connAdmin, "w003Recovered\n")
+	if response != "v003Recovered\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+func TestResetSlotNotAdmin(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "z000\n")
+	if response != "e000013\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	sendData(t, conn, "upepe\n")
+	sendData(t, conn, "ppassw0rd\n")
+
+	response = sendData(t, conn, "z000\n")
+	if response != "e000013\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for slot ownership
+
+func TestReleaseSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "w003Locked\n")
+
+	connTwo, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer connTwo.Close()
+
+	response := sendData(t, connTwo, "f003\n")
+	if response != "e003014\n" {
+		t.Fatalf("only the owner can release the slot: %s", response)
+	}
+
+	response = sendData(t, conn, "h003\n")
+	if response != "v003Locked\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "f003\n")
+	if response != "v003Locked\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, connTwo, "w003Taken\n")
+	if response != "v003Taken\n" {
+		t.Fatalf("slot must be free after release: %s", response)
+	}
+}
+
+func TestAcquireSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "b003Locked\n")
+	if response != "v003Locked\n" {
+		t.Fatalf("free slot must be acquired: %s", response)
+	}
+
+	connTwo, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer connTwo.Close()
+
+	response = sendData(t, connTwo, "b003Next\n")
+	if response != "v0031\n" {
+		t.Fatalf("client must wait in line: %s", response)
+	}
+
+	sendData(t, conn, "f003\n")
+
+	buffer := make([]byte, 40)
+	connTwo.SetReadDeadline(time.Now().Add(time.Second))
+	size, err := connTwo.Read(buffer)
+	if err != nil {
+		t.Fatalf("couldn't read the async event: %v", err)
+	}
+
+	if string(buffer[:size]) != "a003Next\n" {
+		t.Fatalf("unexpected async event: %s", buffer[:size])
+	}
+
+	response = sendData(t, conn, "w003Again\n")
+	if response[0] != 'e' {
+		t.Fatalf("slot must be owned by the waiter: %s", response)
+	}
+}
+
+func TestReleaseNotSupported(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "f000\n")
+	if response != "e000010\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+func TestSessionOwnership(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+
+	response := sendData(t, conn, "w005Job\n")
+	if response[0] != 'e' {
+		t.Fatalf("a session is needed to own the slot: %s", response)
+	}
+
+	response = sendData(t, conn, "kworker-1\n")
+	if response != "vworker-1\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "w005Job\n")
+	if response != "v005Job\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+	conn.Close()
+
+	// The same session keeps the slot after reconnecting
+	connTwo, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer connTwo.Close()
+
+	response = sendData(t, connTwo, "w005Other\n")
+	if response[0] != 'e' {
+		t.Fatalf("slot must be owned by the session: %s", response)
+	}
+
+	sendData(t, connTwo, "kworker-1\n")
+	response = sendData(t, connTwo, "w005Resumed\n")
+	if response != "v005Resumed\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for token buckets
+
+func TestTakeTokens(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "g0067\n")
+	if response != "v0067\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "g0064\n")
+	if response != "v0060\n" {
+		t.Fatalf("tokens must not be taken when there are not enough: %s", response)
+	}
+
+	response = sendData(t, conn, "g006-2\n")
+	if response != "v0062\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "g0065\n")
+	if response != "v0065\n" {
+		t.Fatalf("refunded tokens must be available: %s", response)
+	}
+
+	response = sendData(t, conn, "g006abc\n")
+	if response != "e006009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "g0001\n")
+	if response != "e000010\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+func TestRefundNotTaken(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "g006-2\n")
+	if response != "e006016\n" {
+		t.Fatalf("tokens that were not taken cannot be refunded: %s", response)
+	}
+
+	response = sendData(t, conn, "g0064\n")
+	if response != "v0064\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	connTwo, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer connTwo.Close()
+
+	response = sendData(t, connTwo, "g006-4\n")
+	if response != "e006016\n" {
+		t.Fatalf("tokens taken by other clients cannot be refunded: %s", response)
+	}
+}
+
+func TestKeyedTokenBucket(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "g007customer1|2\n")
+	if response != "v0072\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r007customer1\n")
+	if response != "v0070\n" {
+		t.Fatalf("bucket of the key must be empty: %s", response)
+	}
+
+	response = sendData(t, conn, "r007customer2\n")
+	if response != "v0071\n" {
+		t.Fatalf("every key must have its own bucket: %s", response)
+	}
+
+	response = sendData(t, conn, "r007\n")
+	if response != "e007009\n" {
+		t.Fatalf("keyed slots must be read with a key: %s", response)
+	}
+}
+
+// Tests for expiring values
+
+func TestWriteWithTTL(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "t0001|Flag\n")
+	if response != "v000Flag\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r000\n")
+	if response != "v000Flag\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	response = sendData(t, conn, "r000\n")
+	if response != "v000\n" {
+		t.Fatalf("value must be empty after it expires: %s", response)
+	}
+}
+
+func TestWriteWithTTLNotSupported(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "t0031|Flag\n")
+	if response != "e003010\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "t000x|Flag\n")
+	if response != "e000009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+// Tests for subscriptions
+
+func TestSubscribe(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "s008\n")
+	if response != "e008008\n" {
+		t.Fatalf("users that cannot read must not subscribe: %s", response)
+	}
+
+	sendData(t, conn, "usammy\n")
+	sendData(t, conn, "psamPassw0rd\n")
+
+	subscriber, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer subscriber.Close()
+
+	sendData(t, subscriber, "upepe\n")
+	sendData(t, subscriber, "ppassw0rd\n")
+	response = sendData(t, subscriber, "s008\n")
+	if response != "v008\n" {
+		t.Fatalf("reader must subscribe: %s", response)
+	}
+
+	other, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer other.Close()
+
+	response = sendData(t, other, "s000\n")
+	if response != "v000\n" {
+		t.Fatalf("anonymous users must subscribe to open slots: %s", response)
+	}
+
+	response = sendData(t, conn, "w008Hello\n")
+	if response != "v0081/1/0\n" {
+		t.Fatalf("only the subscriber must receive the broadcast: %s", response)
+	}
+
+	buffer := make([]byte, 40)
+	subscriber.SetReadDeadline(time.Now().Add(time.Second))
+	size, err := subscriber.Read(buffer)
+	if err != nil {
+		t.Fatalf("couldn't read the async event: %v", err)
+	}
+
+	if string(buffer[:size]) != "a008Hello\n" {
+		t.Fatalf("unexpected async event: %s", buffer[:size])
+	}
+
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := other.Read(buffer); err == nil {
+		t.Fatalf("connections not subscribed must not receive the broadcast")
+	}
+
+	response = sendData(t, subscriber, "d008\n")
+	if response != "v008\n" {
+		t.Fatalf("unexpected unsubscribe response: %s", response)
+	}
+
+	response = sendData(t, conn, "w008Again\n")
+	if response != "v0080/0/0\n" {
+		t.Fatalf("unsubscribed connections must not receive the broadcast: %s", response)
+	}
+}
+
+func TestLoginDropsSubscriptions(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "upepe\n")
+	sendData(t, conn, "ppassw0rd\n")
+	sendData(t, conn, "s008\n")
+
+	if s.connections.Subscribers("008") != 1 {
+		t.Fatalf("connection must be subscribed")
+	}
+
+	sendData(t, conn, "ubobby\n")
+	if s.connections.Subscribers("008") != 0 {
+		t.Fatalf("changing the user must drop the subscriptions")
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "s009\n")
+	if response != "v0090\n" {
+		t.Fatalf("subscription must return the last sequence: %s", response)
+	}
+
+	response = sendData(t, conn, "s0001\n")
+	if response != "e000010\n" {
+		t.Fatalf("slots without history cannot replay: %s", response)
+	}
+
+	response = sendData(t, conn, "s009abc\n")
+	if response != "e009009\n" {
+		t.Fatalf("sequence must be a number: %s", response)
+	}
+
+	writer, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer writer.Close()
+
+	sendData(t, writer, "w009Hello\n")
+	sendData(t, writer, "w009World\n")
+
+	late, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer late.Close()
+
+	if _, err := late.Write([]byte("s0091\n")); err != nil {
+		t.Fatalf("couldn't send request: %v", err)
+	}
+
+	reader := bufio.NewReader(late)
+	late.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"a0092|World\n", "v0092\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("couldn't read the response: %v", err)
+		}
+		if line != expected {
+			t.Fatalf("expected %q, got %q", expected, line)
+		}
+	}
+}
+
+func TestAcknowledgedBroadcast(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "y0101\n")
+	if response != "v0101\n" {
+		t.Fatalf("unexpected ack response: %s", response)
+	}
+
+	response = sendData(t, conn, "y0091\n")
+	if response != "e009010\n" {
+		t.Fatalf("slots that are not reliable cannot be acknowledged: %s", response)
+	}
+
+	subscriber, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer subscriber.Close()
+
+	sendData(t, subscriber, "s010\n")
+
+	if _, err := conn.Write([]byte("w010Hello\n")); err != nil {
+		t.Fatalf("couldn't send request: %v", err)
+	}
+
+	reader := bufio.NewReader(subscriber)
+	subscriber.SetReadDeadline(time.Now().Add(time.Second))
+	event, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("couldn't read the async event: %v", err)
+	}
+
+	if event != "a0101|Hello\n" {
+		t.Fatalf("unexpected async event: %s", event)
+	}
+
+	subscriber.Write([]byte("y0101\n"))
+
+	writerReader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	header, err := writerReader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("couldn't read the write response: %v", err)
+	}
+
+	if header != "l0101\n" {
+		t.Fatalf("one subscriber must acknowledge the event: %s", header)
+	}
+
+	line, _ := writerReader.ReadString('\n')
+	if !strings.HasPrefix(line, "v010") || len(line) != 41 {
+		t.Fatalf("the response must contain the connection: %s", line)
+	}
+}
+
+func TestAcknowledgedWriteDoesNotLockSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	lines := sendFramed(t, conn, "t0101|Hello\n")
+	if len(lines) != 0 {
+		t.Fatalf("writes with ttl must return the connections that acknowledged: %v", lines)
+	}
+
+	// The subscriber never acknowledges the events
+	subscriber, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer subscriber.Close()
+	sendData(t, subscriber, "s010\n")
+
+	if _, err := conn.Write([]byte("w010World\n")); err != nil {
+		t.Fatalf("couldn't send request: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	reader, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer reader.Close()
+
+	start := time.Now()
+	response := sendData(t, reader, "i010\n")
+	if !strings.HasPrefix(response, "l010") || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("the slot must not be locked while waiting for acknowledgements: %s %s", response, time.Since(start))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	watcher, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer watcher.Close()
+	reader := bufio.NewReader(watcher)
+
+	response := sendData(t, watcher, "s000>>1\n")
+	if response != "e000009\n" {
+		t.Fatalf("unexpected response for a wrong condition: %s", response)
+	}
+
+	response = sendData(t, watcher, "s006=0\n")
+	if response != "e006010\n" {
+		t.Fatalf("slots without a value must not be watched: %s", response)
+	}
+
+	watcher.Write([]byte("s000=READY\n"))
+	response, _ = reader.ReadString('\n')
+	if response != "v000\n" {
+		t.Fatalf("unexpected watch response: %s", response)
+	}
+
+	sendData(t, conn, "w000WAIT\n")
+	sendData(t, conn, "w000READY\n")
+
+	watcher.SetReadDeadline(time.Now().Add(time.Second))
+	response, err = reader.ReadString('\n')
+	if err != nil || response != "a000watch|READY\n" {
+		t.Fatalf("unexpected async event: %s %v", response, err)
+	}
+
+	sendData(t, conn, "w000WAIT\n")
+	sendData(t, conn, "w000READY\n")
+	watcher.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if response, err := reader.ReadString('\n'); err == nil {
+		t.Fatalf("watches must be notified once: %s", response)
+	}
+
+	watcher.SetReadDeadline(time.Now().Add(time.Second))
+	watcher.Write([]byte("s000=READY\n"))
+	first, _ := reader.ReadString('\n')
+	second, _ := reader.ReadString('\n')
+	if first != "v000\n" || second != "a000watch|READY\n" {
+		t.Fatalf("the condition must be checked when watching: %s %s", first, second)
+	}
+}
+
+func TestWatchRemovedOnDisconnect(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	watcher, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+
+	response := sendData(t, watcher, "s000=READY\n")
+	if response != "v000\n" {
+		t.Fatalf("unexpected watch response: %s", response)
+	}
+
+	// The client hangs up without sending the quit command
+	watcher.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.watches.mu.Lock()
+		watches, followed := len(s.watches.watches), len(s.watches.followers)
+		s.watches.mu.Unlock()
+		if watches == 0 && followed == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the watches must be removed when the client disconnects: %d %d", watches, followed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchRepeating(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	watcher, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer watcher.Close()
+	reader := bufio.NewReader(watcher)
+
+	watcher.Write([]byte("s011*>=2\n"))
+	response, _ := reader.ReadString('\n')
+	if response != "v011\n" {
+		t.Fatalf("unexpected watch response: %s", response)
+	}
+
+	for _, expected := range []string{"v0111\n", "v0112\n", "v0113\n"} {
+		response = sendData(t, conn, "r011\n")
+		if response != expected {
+			t.Fatalf("unexpected counter value: %s", response)
+		}
+	}
+
+	watcher.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"a011watch|2\n", "a011watch|3\n"} {
+		response, err = reader.ReadString('\n')
+		if err != nil || response != expected {
+			t.Fatalf("unexpected async event: %s %v", response, err)
+		}
+	}
+
+	watcher.Write([]byte("d011\n"))
+	response, _ = reader.ReadString('\n')
+	if response != "v011\n" {
+		t.Fatalf("unexpected unsubscribe response: %s", response)
+	}
+
+	sendData(t, conn, "r011\n")
+	watcher.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if response, err := reader.ReadString('\n'); err == nil {
+		t.Fatalf("the watch must be removed: %s", response)
+	}
+}
+
+func TestWatchExpiration(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	watcher, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer watcher.Close()
+	reader := bufio.NewReader(watcher)
+
+	sendData(t, conn, "t0001|Flag\n")
+	watcher.Write([]byte("s000!=Flag\n"))
+	response, _ := reader.ReadString('\n')
+	if response != "v000\n" {
+		t.Fatalf("unexpected watch response: %s", response)
+	}
+
+	// Nobody sends a command, the expiration changes the value
+	watcher.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err = reader.ReadString('\n')
+	if err != nil || response != "a000watch|\n" {
+		t.Fatalf("the expiration must fire the watch: %s %v", response, err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "w012color|blue\n")
+	if response != "v012blue\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "t01260|size|10\n")
+	if response != "v01210\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r012color\n")
+	if response != "v012blue\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "r012\n")
+	if response != "e012009\n" {
+		t.Fatalf("maps must be read with a key: %s", response)
+	}
+
+	response = sendData(t, conn, "o012size\n")
+	if response != "v0122\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	lines := sendFramed(t, conn, "o012list\n")
+	if len(lines) != 2 || lines[0] != "v012color\n" || lines[1] != "v012size\n" {
+		t.Fatalf("unexpected keys: %v", lines)
+	}
+
+	lines = sendFramed(t, conn, "o012list|color\n")
+	if len(lines) != 1 || lines[0] != "v012size\n" {
+		t.Fatalf("unexpected keys after color: %v", lines)
+	}
+
+	response = sendData(t, conn, "o012del|color\n")
+	if response != "v012true\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "o012del|color\n")
+	if response != "v012false\n" {
+		t.Fatalf("removed keys must not exist: %s", response)
+	}
+
+	response = sendData(t, conn, "o012pop\n")
+	if response != "e012009\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "o000size\n")
+	if response != "e000010\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	sendData(t, conn, "upepe\n")
+	sendData(t, conn, "ppassw0rd\n")
+
+	response := sendData(t, conn, "o013add|eu-west\n")
+	if response != "e013006\n" {
+		t.Fatalf("readers must not add members: %s", response)
+	}
+
+	sendData(t, conn, "usammy\n")
+	sendData(t, conn, "psamPassw0rd\n")
+
+	response = sendData(t, conn, "o013add|eu-west\n")
+	if response != "v013true\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "o013add|eu-west\n")
+	if response != "v013false\n" {
+		t.Fatalf("members must be added once: %s", response)
+	}
+
+	sendData(t, conn, "o013add|us-east\n")
+
+	response = sendData(t, conn, "o013has|us-east\n")
+	if response != "v013true\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "o013size\n")
+	if response != "v0132\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	lines := sendFramed(t, conn, "o013list\n")
+	if len(lines) != 2 || lines[0] != "v013eu-west\n" || lines[1] != "v013us-east\n" {
+		t.Fatalf("unexpected members: %v", lines)
+	}
+
+	response = sendData(t, conn, "o013del|eu-west\n")
+	if response != "v013true\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	response = sendData(t, conn, "o013has|eu-west\n")
+	if response != "v013false\n" {
+		t.Fatalf("removed members must not belong to the set: %s", response)
+	}
+
+	response = sendData(t, conn, "o012add|eu-west\n")
+	if response != "e012010\n" {
+		t.Fatalf("maps must not add members: %s", response)
+	}
+}
+
+func TestSystemSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "r995\n")
+	if response != "v995standard\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	other, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer other.Close()
+
+	// Clients are counted without metrics
+	response = sendData(t, other, "r991\n")
+	if response != "v9912\n" {
+		t.Fatalf("unexpected number of clients: %s", response)
+	}
+
+	response = sendData(t, conn, "w995telnet\n")
+	if response != "e995006\n" {
+		t.Fatalf("system slots must not be written: %s", response)
+	}
+}
+
+func TestBlockingRead(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	reader, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer reader.Close()
+
+	response := sendData(t, reader, "n006\n")
+	if response != "e006010\n" {
+		t.Fatalf("slots without versions must not be read blocking: %s", response)
+	}
+
+	response = sendData(t, reader, "n000x\n")
+	if response != "e000009\n" {
+		t.Fatalf("unexpected response for a wrong version: %s", response)
+	}
+
+	sendData(t, conn, "w000first\n")
+	response = sendData(t, reader, "n000\n")
+	if response != "v0001|first\n" {
+		t.Fatalf("the current value must be returned without version: %s", response)
+	}
+
+	response = sendData(t, reader, "n0000|1\n")
+	if response != "v0001|first\n" {
+		t.Fatalf("newer values must be returned immediately: %s", response)
+	}
+
+	response = sendData(t, reader, "n0001|0\n")
+	if response != "v0001|first\n" {
+		t.Fatalf("the current value must be returned on timeout: %s", response)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		sendData(t, conn, "w000second\n")
+	}()
+
+	start := time.Now()
+	reader.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reader.Write([]byte("n0001|5\n"))
+	response, err = bufio.NewReader(reader).ReadString('\n')
+	if err != nil || response != "v0002|second\n" {
+		t.Fatalf("the read must return the next value: %s %v", response, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("the read must return when the slot is written")
+	}
+}
+
+func TestBlockingReadHangup(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	reader, err := net.Dial("tcp", s.connections.GetAddr())
+	if err != nil {
+		t.Fatalf("couldn't connect to the server: %v", err)
+	}
+	defer reader.Close()
+
+	// The commands sent while waiting run after the response
+	reader.Write([]byte("n0000|5\n"))
+	time.Sleep(100 * time.Millisecond)
+	reader.Write([]byte("r000\n"))
+	time.Sleep(100 * time.Millisecond)
+	sendData(t, conn, "w000first\n")
+
+	reader.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffered := bufio.NewReader(reader)
+	first, _ := buffered.ReadString('\n')
+	second, _ := buffered.ReadString('\n')
+	if first != "v0001|first\n" || second != "v000first\n" {
+		t.Fatalf("unexpected responses: %s %s", first, second)
+	}
+
+	reader.Write([]byte("n0001|300\n"))
+	time.Sleep(100 * time.Millisecond)
+	reader.Close()
+
+	// The connection is removed when the client hangs up while waiting
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if sendData(t, conn, "r991\n") == "v9911\n" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("the blocking read must stop when the client hangs up")
+}
+
+func TestSequenceSlot(t *testing.T) {
+	s, conn := runServer(t)
+	defer s.Stop()
+	defer conn.Close()
+
+	response := sendData(t, conn, "r015\n")
+	if response != "v0151\n" {
+		t.Fatalf("unexpected server response: %s", response)
+	}
+
+	lines := sendFramed(t, conn, "l015\n")
+	if len(lines) != 1 || lines[0] != "v0152\n" {
+		t.Fatalf("unexpected multi read response: %v", lines)
+	}
+
+	response = sendData(t, conn, "r015\n")
+	if response != "e015015\n" {
+		t.Fatalf("exhausted sequences must return an error: %s", response)
+	}
+
+	response = sendData(t, conn, "w0155\n")
+	if response != "e015006\n" {
+		t.Fatalf("sequence slots must not be written: %s", response)
+	}
+}
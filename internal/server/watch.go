@@ -0,0 +1,205 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// watchOperators are the comparisons supported by the watch conditions, the
+// operators with two characters must be checked first.
+var watchOperators = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// condition is a comparison of the value of a slot with an operand. Equality
+// compares the values as text, the other comparisons only hold when both
+// values are numbers.
+type condition struct {
+	operator string
+	operand  string
+}
+
+// isCondition reports whether the value of a subscription is a condition.
+func isCondition(value string) bool {
+	return value != "" && strings.ContainsRune("*=!<>", rune(value[0]))
+}
+
+// parseCondition parses a condition like ">1000" or "=READY", a condition
+// starting with an asterisk is repeating.
+func parseCondition(value string) (condition, bool, error) {
+	repeat := strings.HasPrefix(value, "*")
+	value = strings.TrimPrefix(value, "*")
+
+	for _, operator := range watchOperators {
+		operand, found := strings.CutPrefix(value, operator)
+		if !found {
+			continue
+		}
+
+		if operator != "=" && operator != "!=" {
+			if _, err := strconv.ParseFloat(operand, 64); err != nil {
+				return condition{}, false, errors.New("operand must be a number")
+			}
+		}
+
+		return condition{operator: operator, operand: operand}, repeat, nil
+	}
+
+	return condition{}, false, errors.New("unknown operator")
+}
+
+func (c condition) holds(value string) bool {
+	switch c.operator {
+	case "=":
+		return value == c.operand
+	case "!=":
+		return value != c.operand
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	operand, _ := strconv.ParseFloat(c.operand, 64)
+	switch c.operator {
+	case ">":
+		return number > operand
+	case ">=":
+		return number >= operand
+	case "<":
+		return number < operand
+	default:
+		return number <= operand
+	}
+}
+
+// watch is a condition a connection waits for on a slot, a watch that is
+// not repeating is removed the first time the condition holds. The last
+// value checked is kept so a value is not checked twice.
+type watch struct {
+	id      string
+	user    auth.User
+	cond    condition
+	repeat  bool
+	checked bool
+	value   string
+}
+
+// watchList keeps the watches of every slot, a connection has at most one
+// watch on each slot. Every slot with watches is followed by a goroutine
+// that checks them when the slot changes, it is stopped by closing its
+// channel when the last watch of the slot is removed.
+type watchList struct {
+	mu        sync.Mutex
+	watches   map[int]map[string]watch
+	followers map[int]chan struct{}
+}
+
+func newWatchList() *watchList {
+	return &watchList{
+		watches:   make(map[int]map[string]watch),
+		followers: make(map[int]chan struct{}),
+	}
+}
+
+// add sets the watch of the connection on the slot. When the slot is not
+// followed yet it returns the channel that stops the new follower.
+func (l *watchList) add(slot int, w watch) (chan struct{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.watches[slot] == nil {
+		l.watches[slot] = make(map[string]watch)
+	}
+	l.watches[slot][w.id] = w
+
+	if _, ok := l.followers[slot]; ok {
+		return nil, false
+	}
+
+	done := make(chan struct{})
+	l.followers[slot] = done
+	return done, true
+}
+
+func (l *watchList) remove(slot int, id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.watches[slot], id)
+	l.stopIfEmpty(slot)
+}
+
+// removeAll removes the watches of the connection on every slot.
+func (l *watchList) removeAll(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for slot, watches := range l.watches {
+		delete(watches, id)
+		l.stopIfEmpty(slot)
+	}
+}
+
+// stopIfEmpty stops following the slot when it has no watches, it must be
+// called holding the lock.
+func (l *watchList) stopIfEmpty(slot int) {
+	if len(l.watches[slot]) > 0 {
+		return
+	}
+
+	delete(l.watches, slot)
+	if done, ok := l.followers[slot]; ok {
+		close(done)
+		delete(l.followers, slot)
+	}
+}
+
+// matching returns the watches of the slot whose condition holds for the
+// value when it was not checked before, the watches that are not repeating
+// are removed. When an id is given only the watch of that connection is
+// checked.
+func (l *watchList) matching(slot int, value string, id string) []watch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var matched []watch
+	for watchID, w := range l.watches[slot] {
+		if id != "" && watchID != id {
+			continue
+		}
+
+		if w.checked && w.value == value {
+			continue
+		}
+
+		w.checked = true
+		w.value = value
+		l.watches[slot][watchID] = w
+		if !w.cond.holds(value) {
+			continue
+		}
+
+		matched = append(matched, w)
+		if !w.repeat {
+			delete(l.watches[slot], watchID)
+		}
+	}
+
+	l.stopIfEmpty(slot)
+	return matched
+}
+
+// watchEvent is the async event sent when the condition of a watch holds.
+func watchEvent(slot string, value string) string {
+	var sb strings.Builder
+	sb.WriteString("a")
+	sb.WriteString(slot)
+	sb.WriteString("watch|")
+	sb.WriteString(value)
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -11,14 +11,16 @@ import (
 )
 
 type atomicSlot struct {
-	users map[string]string
-	value int64
-	mu    sync.RWMutex
+	users    map[string]string
+	value    int64
+	notifier *notifier
+	versions versions
+	mu       sync.RWMutex
 }
 
 func (a *atomicSlot) Read() string {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
 	if math.MaxInt64 == a.value {
 		a.value = 0
@@ -26,9 +28,69 @@ func (a *atomicSlot) Read() string {
 		a.value++
 	}
 
+	a.versions.bump()
+	a.notifier.notify("write", strconv.FormatInt(a.value, 10))
+	return strconv.FormatInt(a.value, 10)
+}
+
+// Peek returns the current value without incrementing it, without the
+// changes of a batch that is running.
+func (a *atomicSlot) Peek() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.versions.visible(strconv.FormatInt(a.value, 10))
+}
+
+func (a *atomicSlot) Since(version uint64) (uint64, string, <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	number, changed := a.versions.since(version)
+	return number, a.versions.visible(strconv.FormatInt(a.value, 10)), changed
+}
+
+// Save returns a function that commits or restores the value of the counter.
+func (a *atomicSlot) Save() func(bool) {
+	a.mu.Lock()
+	value := a.value
+	a.versions.hold(strconv.FormatInt(value, 10))
+	a.notifier.hold()
+	a.mu.Unlock()
+
+	return func(commit bool) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		if !commit {
+			a.value = value
+		}
+		a.versions.release(commit)
+		a.notifier.release(commit)
+	}
+}
+
+func (a *atomicSlot) Reset() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.value = 0
+	a.versions.bump()
+	a.notifier.notify("reset", "")
 	return strconv.FormatInt(a.value, 10)
 }
 
+func (a *atomicSlot) Info() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return []string{
+		"kind=atomic",
+		"value=" + strconv.FormatInt(a.value, 10),
+		"notify=" + strconv.FormatBool(a.notifier.enabled()),
+	}
+}
+
 func (a *atomicSlot) CanRead(u *auth.User) bool {
 	if len(a.users) == 0 {
 		return true
@@ -57,6 +119,8 @@ func (a *atomicSlot) Write(data string, from net.Conn) (string, error) {
 
 	a.mu.Lock()
 	a.value = dataInt
+	a.versions.bump()
+	a.notifier.notify("write", strconv.FormatInt(dataInt, 10))
 	a.mu.Unlock()
 
 	return strconv.FormatInt(dataInt, 10), nil
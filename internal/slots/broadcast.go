@@ -1,28 +1,72 @@
 package slots
 
 import (
+	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
 	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
 )
 
+// SupportedCoalesceModes are the events sent when the coalesce window of a
+// broadcast slot closes: the latest value written or the number of writes.
+var SupportedCoalesceModes = map[string]bool{
+	"latest": true,
+	"count":  true,
+}
+
 type broadcastSlot struct {
-	users   map[string]string
-	value   string
-	slotID  string
-	mu      sync.RWMutex
-	manager connectionmanager.ConnectionManager
+	users       map[string]string
+	value       string
+	slotID      string
+	expiration  expiration
+	expireEvent bool
+	historySize int
+	history     []historyEvent
+	seq         uint64
+	reliable    bool
+	ackTimeout  time.Duration
+	ackRetry    time.Duration
+	pending     map[uint64]*pendingAck
+	coalesce    time.Duration
+	coalesceBy  string
+	coalesced   int
+	window      *time.Timer
+	windowEnds  time.Time
+	versions    versions
+	mu          sync.RWMutex
+	writeMu     sync.Mutex
+	manager     connectionmanager.ConnectionManager
+}
+
+// pendingAck is an event that waits for the acknowledgement of the
+// subscribers, done is closed when all of them acknowledged it.
+type pendingAck struct {
+	waiting map[string]bool
+	acked   []string
+	done    chan struct{}
+}
+
+// historyEvent is an event kept by a broadcast slot with history.
+type historyEvent struct {
+	seq   uint64
+	event string
 }
 
 func newBroadcastSlot(users map[string]string, conn connectionmanager.ConnectionManager, id string) *broadcastSlot {
 	return &broadcastSlot{
-		users:   users,
-		value:   "",
-		manager: conn,
-		slotID:  id,
+		users:      users,
+		value:      "",
+		manager:    conn,
+		slotID:     id,
+		ackTimeout: 300 * time.Millisecond,
+		ackRetry:   100 * time.Millisecond,
+		pending:    make(map[uint64]*pendingAck),
+		coalesceBy: "latest",
 	}
 }
 
@@ -30,9 +74,68 @@ func (m *broadcastSlot) Read() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	if m.expiration.expired() {
+		return ""
+	}
+
+	return m.value
+}
+
+func (m *broadcastSlot) Peek() string {
+	return m.Read()
+}
+
+func (m *broadcastSlot) Since(version uint64) (uint64, string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number, changed := m.versions.since(version)
+	if m.expiration.expired() {
+		return number, "", changed
+	}
+	return number, m.value, changed
+}
+
+// Reset clears the last value written, no event is broadcasted. The history
+// and the sequence numbers are kept so subscribers never see them go back.
+func (m *broadcastSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value = ""
+	m.versions.bump()
+	m.expiration.clear()
+	if m.window != nil {
+		m.window.Stop()
+		m.window = nil
+		m.coalesced = 0
+	}
 	return m.value
 }
 
+func (m *broadcastSlot) Info() []string {
+	m.mu.RLock()
+	defaultTTL := m.expiration.defaultTTL
+	remaining := m.expiration.remaining()
+	coalesced := m.coalesced
+	m.mu.RUnlock()
+
+	return []string{
+		"kind=broadcast",
+		"subscribers=" + strconv.Itoa(m.manager.Subscribers(m.slotID)),
+		"default_ttl=" + strconv.FormatInt(int64(defaultTTL/time.Second), 10),
+		"expire_event=" + strconv.FormatBool(m.expireEvent),
+		"ttl_ms=" + strconv.FormatInt(remaining.Milliseconds(), 10),
+		"history=" + strconv.Itoa(m.historySize),
+		"sequence=" + strconv.FormatUint(m.Sequence(), 10),
+		"reliable=" + strconv.FormatBool(m.reliable),
+		"ack_timeout=" + strconv.FormatInt(m.ackTimeout.Milliseconds(), 10),
+		"coalesce_ms=" + strconv.FormatInt(m.coalesce.Milliseconds(), 10),
+		"coalesce_mode=" + m.coalesceBy,
+		"coalesced=" + strconv.Itoa(coalesced),
+	}
+}
+
 func (m *broadcastSlot) CanRead(u *auth.User) bool {
 	if len(m.users) == 0 {
 		return true
@@ -50,19 +153,290 @@ func (m *broadcastSlot) CanWrite(u *auth.User) bool {
 }
 
 func (m *broadcastSlot) Write(data string, from net.Conn) (string, error) {
+	return m.WriteWithTTL(data, m.expiration.defaultTTL, from)
+}
+
+func (m *broadcastSlot) WriteWithTTL(data string, ttl time.Duration, from net.Conn) (string, error) {
+	if m.reliable {
+		acked, sent := m.writeAcknowledged(data, ttl)
+		return fmt.Sprintf("%d/%d/%d", len(acked), sent, sent-len(acked)), nil
+	}
+
+	if m.coalesce > 0 {
+		return m.writeCoalesced(data, ttl), nil
+	}
+
 	m.mu.Lock()
 	m.value = data
+	m.versions.bump()
+	m.expiration.set(ttl, m.expire)
+	event := m.event(data)
 	m.mu.Unlock()
 
+	response, err := m.manager.Broadcast(m.slotID, event, m.CanRead)
+	if err != nil {
+		return "", err
+	}
+
+	return response, nil
+}
+
+// expire clears the value, when expire events are enabled an empty event is
+// broadcasted to notify that it expired.
+func (m *broadcastSlot) expire(expires time.Time) {
+	m.mu.Lock()
+	if !m.expiration.expires.Equal(expires) {
+		m.mu.Unlock()
+		return
+	}
+	m.value = ""
+	m.versions.bump()
+	m.expiration.clear()
+	if !m.expireEvent {
+		m.mu.Unlock()
+		return
+	}
+	event := m.event("")
+	m.mu.Unlock()
+
+	m.manager.Broadcast(m.slotID, event, m.CanRead)
+}
+
+// writeCoalesced writes the value without sending the event, the first write
+// opens a window and a single event is sent when it closes. It returns the
+// number of writes in the window.
+func (m *broadcastSlot) writeCoalesced(data string, ttl time.Duration) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value = data
+	m.versions.bump()
+	m.expiration.set(ttl, m.expire)
+	m.coalesced++
+	if m.window == nil {
+		ends := time.Now().Add(m.coalesce)
+		m.windowEnds = ends
+		m.window = time.AfterFunc(m.coalesce, func() { m.flush(ends) })
+	}
+
+	return strconv.Itoa(m.coalesced)
+}
+
+// flush closes the coalesce window and sends the latest value or the number
+// of writes in the window.
+func (m *broadcastSlot) flush(ends time.Time) {
+	m.mu.Lock()
+	if m.window == nil || !m.windowEnds.Equal(ends) {
+		m.mu.Unlock()
+		return
+	}
+
+	data := m.value
+	if m.coalesceBy == "count" {
+		data = strconv.Itoa(m.coalesced)
+	}
+	m.window = nil
+	m.coalesced = 0
+	event := m.event(data)
+	m.mu.Unlock()
+
+	m.manager.Broadcast(m.slotID, event, m.CanRead)
+}
+
+// IsReliable reports whether the events of the slot must be acknowledged.
+func (m *broadcastSlot) IsReliable() bool {
+	return m.reliable
+}
+
+// WriteAcknowledged writes the slot and returns the connections that
+// acknowledged the event before the ack timeout.
+func (m *broadcastSlot) WriteAcknowledged(data string) ([]string, error) {
+	return m.WriteAcknowledgedWithTTL(data, m.expiration.defaultTTL)
+}
+
+// WriteAcknowledgedWithTTL writes a value that expires and returns the
+// connections that acknowledged the event before the ack timeout.
+func (m *broadcastSlot) WriteAcknowledgedWithTTL(data string, ttl time.Duration) ([]string, error) {
+	acked, _ := m.writeAcknowledged(data, ttl)
+	return acked, nil
+}
+
+// writeAcknowledged sends the event to the subscribers until all of them
+// acknowledge it or the ack timeout passes, on every retry the event is sent
+// again to the subscribers that did not acknowledge it. The event is sent to
+// the subscribers at the same time, without waiting for the previous ones,
+// so the whole write never takes longer than the ack timeout. It returns the
+// connections that acknowledged it and the number of subscribers.
+func (m *broadcastSlot) writeAcknowledged(data string, ttl time.Duration) ([]string, int) {
+	// The writes are serialized until the event is queued in every
+	// subscriber, so the events are queued in the order of their sequence
+	// numbers and the subscribers never receive them out of order
+	m.writeMu.Lock()
+
+	// The receivers are taken before locking the slot, the manager locks
+	// the slot to replay its history while holding its own lock
+	pending := &pendingAck{waiting: make(map[string]bool), done: make(chan struct{})}
+	for _, id := range m.manager.Receivers(m.slotID, m.CanRead) {
+		pending.waiting[id] = true
+	}
+
+	m.mu.Lock()
+	m.value = data
+	m.versions.bump()
+	m.expiration.set(ttl, m.expire)
+	event := m.event(data)
+	seq := m.seq
+
+	sent := len(pending.waiting)
+	if sent == 0 {
+		close(pending.done)
+	}
+	m.pending[seq] = pending
+	m.mu.Unlock()
+
+	deadline := time.NewTimer(m.ackTimeout)
+	defer deadline.Stop()
+	retry := time.NewTicker(m.ackRetry)
+	defer retry.Stop()
+
+	// A subscriber is not sent the event again while the previous delivery
+	// is still waiting for the connection
+	var sending sync.Map
+	send := func(id string) {
+		if _, busy := sending.LoadOrStore(id, true); busy {
+			return
+		}
+
+		go func() {
+			defer sending.Delete(id)
+			m.manager.Send(id, event)
+		}()
+	}
+
+	// The first delivery is queued holding the write lock, only the wait
+	// for the connections happens after releasing it
+	for _, id := range m.waiting(pending) {
+		wait, err := m.manager.Queue(id, event)
+		if err != nil {
+			continue
+		}
+
+		sending.Store(id, true)
+		go func() {
+			defer sending.Delete(id)
+			wait()
+		}()
+	}
+	m.writeMu.Unlock()
+
+deliver:
+	for waiting := m.waiting(pending); len(waiting) > 0; waiting = m.waiting(pending) {
+		for _, id := range waiting {
+			send(id)
+		}
+
+		select {
+		case <-pending.done:
+		case <-deadline.C:
+			break deliver
+		case <-retry.C:
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pending, seq)
+	return pending.acked, sent
+}
+
+// waiting returns the subscribers that did not acknowledge the event yet.
+func (m *broadcastSlot) waiting(pending *pendingAck) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(pending.waiting))
+	for id := range pending.waiting {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Ack registers that the connection received the event with the sequence
+// number, acknowledgements of events that are not waiting are ignored.
+func (m *broadcastSlot) Ack(seq uint64, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, ok := m.pending[seq]
+	if !ok || !pending.waiting[id] {
+		return
+	}
+
+	delete(pending.waiting, id)
+	pending.acked = append(pending.acked, id)
+	if len(pending.waiting) == 0 {
+		close(pending.done)
+	}
+}
+
+// event builds the async event for the data. On slots with history or
+// reliable slots the events carry a sequence number before the data
+// (a000<seq>|<data>), the last ones are kept to be replayed on slots with
+// history. It must be called holding the lock.
+func (m *broadcastSlot) event(data string) string {
 	var sb strings.Builder
 	sb.WriteString("a")
 	sb.WriteString(m.slotID)
+	if m.historySize == 0 && !m.reliable {
+		sb.WriteString(data)
+		sb.WriteString("\n")
+		return sb.String()
+	}
+
+	m.seq++
+	sb.WriteString(strconv.FormatUint(m.seq, 10))
+	sb.WriteString("|")
 	sb.WriteString(data)
 	sb.WriteString("\n")
-	response, err := m.manager.Broadcast(sb.String())
-	if err != nil {
-		return "", err
+
+	if m.historySize == 0 {
+		return sb.String()
 	}
 
-	return response, nil
+	if len(m.history) == m.historySize {
+		m.history = m.history[1:]
+	}
+	m.history = append(m.history, historyEvent{seq: m.seq, event: sb.String()})
+	return sb.String()
+}
+
+// Replay returns the events kept with a sequence number bigger than the
+// given one, oldest first. Events older than the history are lost.
+func (m *broadcastSlot) Replay(after uint64) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []string{}
+	for _, h := range m.history {
+		if h.seq > after {
+			events = append(events, h.event)
+		}
+	}
+
+	return events
+}
+
+// Sequence returns the sequence number of the last event.
+func (m *broadcastSlot) Sequence() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.seq
+}
+
+// HasHistory reports whether the events of the slot are numbered and kept.
+func (m *broadcastSlot) HasHistory() bool {
+	return m.historySize > 0
 }
@@ -2,20 +2,70 @@ package slots
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/spf13/viper"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
 	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
+	"github.com/dankomiocevic/ghoti/internal/errs"
 )
 
 type MockConnectionManager struct {
 	BroadcastFunc func(message string) (string, error)
+	SendFunc      func(id string, message string) error
+	QueueFunc     func(id string, message string)
+	ReceiversList []string
 }
 
-func (m *MockConnectionManager) Broadcast(message string) (string, error) {
+func (m *MockConnectionManager) Broadcast(slot string, message string, canRead connectionmanager.ReadChecker) (string, error) {
 	return m.BroadcastFunc(message)
 }
 
+func (m *MockConnectionManager) Receivers(string, connectionmanager.ReadChecker) []string {
+	return m.ReceiversList
+}
+
+func (m *MockConnectionManager) Subscribe(string, string, auth.User) error {
+	return nil
+}
+
+func (m *MockConnectionManager) Unsubscribe(string, string) {
+}
+
+func (m *MockConnectionManager) UnsubscribeAll(string) {
+}
+
+func (m *MockConnectionManager) SubscribeAfter(string, string, auth.User, uint64, func() []string) error {
+	return nil
+}
+
+func (m *MockConnectionManager) Send(id string, data string) error {
+	return m.SendFunc(id, data)
+}
+
+func (m *MockConnectionManager) Queue(id string, data string) (func() error, error) {
+	if m.QueueFunc != nil {
+		m.QueueFunc(id, data)
+	}
+
+	return func() error {
+		return m.SendFunc(id, data)
+	}, nil
+}
+
+func (m *MockConnectionManager) Subscribers(string) int {
+	return 3
+}
+
+func (m *MockConnectionManager) Connected() int {
+	return 5
+}
+
 func (m *MockConnectionManager) StartListening(string) error {
 	return nil
 }
@@ -27,6 +77,9 @@ func (m *MockConnectionManager) ServeConnections(connectionmanager.CallbackFn) e
 func (m *MockConnectionManager) Delete(string) {
 }
 
+func (m *MockConnectionManager) OnDelete(func(string)) {
+}
+
 func (m *MockConnectionManager) GetAddr() string {
 	return ""
 }
@@ -126,3 +179,315 @@ func TestBroadcastSlotWriteManagerFailure(t *testing.T) {
 		t.Fatalf("Error should be returned when manager broadcast fails")
 	}
 }
+
+func TestBroadcastSlotInfo(t *testing.T) {
+	slot := loadBroadcastSlot(t)
+
+	info := slot.Info()
+	if info[0] != "kind=broadcast" || info[1] != "subscribers=3" {
+		t.Fatalf("unexpected info: %v", info)
+	}
+}
+
+func TestBroadcastSlotWriteWithTTL(t *testing.T) {
+	slot := loadBroadcastSlot(t)
+
+	slot.WriteWithTTL("short", 20*time.Millisecond, nil)
+	if slot.Read() != "short" {
+		t.Fatalf("Value should be 'short' before it expires")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if slot.Read() != "" {
+		t.Fatalf("Value should be empty after it expires")
+	}
+}
+
+func TestBroadcastSlotHistory(t *testing.T) {
+	events := []string{}
+	manager := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events = append(events, message)
+			return "mock response", nil
+		},
+	}
+	slot := newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.historySize = 2
+
+	slot.Write("one", nil)
+	slot.Write("two", nil)
+	slot.Write("three", nil)
+
+	if events[0] != "a0011|one\n" || events[2] != "a0013|three\n" {
+		t.Fatalf("events must carry the sequence number: %v", events)
+	}
+
+	if slot.Sequence() != 3 {
+		t.Fatalf("Sequence should be 3, got %d", slot.Sequence())
+	}
+
+	replayed := slot.Replay(0)
+	if len(replayed) != 2 || replayed[0] != "a0012|two\n" || replayed[1] != "a0013|three\n" {
+		t.Fatalf("only the last events must be kept: %v", replayed)
+	}
+
+	replayed = slot.Replay(2)
+	if len(replayed) != 1 || replayed[0] != "a0013|three\n" {
+		t.Fatalf("only the events after the sequence must be replayed: %v", replayed)
+	}
+
+	if len(slot.Replay(3)) != 0 {
+		t.Fatalf("no events must be replayed for the last sequence")
+	}
+
+	info := slot.Info()
+	if info[5] != "history=2" || info[6] != "sequence=3" {
+		t.Fatalf("unexpected info: %v", info)
+	}
+}
+
+func TestBroadcastSlotWithoutHistory(t *testing.T) {
+	events := []string{}
+	manager := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events = append(events, message)
+			return "mock response", nil
+		},
+	}
+	slot := newBroadcastSlot(make(map[string]string), manager, "001")
+
+	slot.Write("one", nil)
+	if events[0] != "a001one\n" {
+		t.Fatalf("events must not be numbered without history: %v", events)
+	}
+
+	if slot.HasHistory() || len(slot.Replay(0)) != 0 {
+		t.Fatalf("events must not be kept without history")
+	}
+}
+
+func TestBroadcastSlotReliable(t *testing.T) {
+	var slot *broadcastSlot
+	var mu sync.Mutex
+	sends := make(map[string]int)
+	manager := &MockConnectionManager{
+		ReceiversList: []string{"acked", "lost"},
+		SendFunc: func(id string, message string) error {
+			if message != "a0011|hello\n" {
+				t.Errorf("unexpected event: %s", message)
+			}
+			mu.Lock()
+			sends[id]++
+			mu.Unlock()
+			if id == "acked" {
+				slot.Ack(1, id)
+			}
+			return nil
+		},
+	}
+	slot = newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.reliable = true
+	slot.ackTimeout = 50 * time.Millisecond
+	slot.ackRetry = 10 * time.Millisecond
+
+	acked, err := slot.WriteAcknowledged("hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(acked) != 1 || acked[0] != "acked" {
+		t.Fatalf("only the connection that acknowledged must be returned: %v", acked)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sends["acked"] != 1 {
+		t.Fatalf("acknowledged events must not be sent again: %d", sends["acked"])
+	}
+
+	if sends["lost"] < 2 {
+		t.Fatalf("events not acknowledged must be retried: %d", sends["lost"])
+	}
+
+	if slot.Read() != "hello" {
+		t.Fatalf("Value should be 'hello'")
+	}
+
+	if len(slot.pending) != 0 {
+		t.Fatalf("events must not be pending after the write")
+	}
+}
+
+func TestBroadcastSlotReliableAllAcked(t *testing.T) {
+	var slot *broadcastSlot
+	manager := &MockConnectionManager{
+		ReceiversList: []string{"one", "two"},
+		SendFunc: func(id string, message string) error {
+			slot.Ack(1, id)
+			return nil
+		},
+	}
+	slot = newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.reliable = true
+	slot.ackTimeout = time.Second
+
+	start := time.Now()
+	response, _ := slot.Write("hello", nil)
+	if response != "2/2/0" {
+		t.Fatalf("unexpected response: %s", response)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("the write must not wait for the timeout when all subscribers acknowledged")
+	}
+}
+
+func TestBroadcastSlotReliableSlowSubscribers(t *testing.T) {
+	var sent atomic.Int32
+	manager := &MockConnectionManager{
+		ReceiversList: []string{"one", "two", "three", "four"},
+		SendFunc: func(id string, message string) error {
+			sent.Add(1)
+			time.Sleep(200 * time.Millisecond)
+			return errs.TranscientError{Err: "Timeout waiting for callback"}
+		},
+	}
+	slot := newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.reliable = true
+	slot.ackTimeout = 100 * time.Millisecond
+	slot.ackRetry = 10 * time.Millisecond
+
+	start := time.Now()
+	acked, _ := slot.WriteAcknowledged("hello")
+	if len(acked) != 0 {
+		t.Fatalf("no subscriber acknowledged the event: %v", acked)
+	}
+
+	if time.Since(start) > 180*time.Millisecond {
+		t.Fatalf("the write must not wait longer than the ack timeout: %s", time.Since(start))
+	}
+
+	if sent.Load() != 4 {
+		t.Fatalf("the event must be sent to every subscriber once while they are busy: %d", sent.Load())
+	}
+}
+
+func TestBroadcastSlotCoalesce(t *testing.T) {
+	events := make(chan string, 10)
+	manager := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events <- message
+			return "mock response", nil
+		},
+	}
+	slot := newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.coalesce = 30 * time.Millisecond
+
+	for i, value := range []string{"one", "two", "three"} {
+		response, _ := slot.Write(value, nil)
+		if response != strconv.Itoa(i+1) {
+			t.Fatalf("write must return the writes in the window: %s", response)
+		}
+	}
+
+	if slot.Read() != "three" {
+		t.Fatalf("Value should be 'three' before the window closes")
+	}
+
+	select {
+	case event := <-events:
+		if event != "a001three\n" {
+			t.Fatalf("only the latest value must be sent: %s", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event must be sent when the window closes")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("only one event must be sent: %s", event)
+	case <-time.After(60 * time.Millisecond):
+	}
+
+	slot.coalesceBy = "count"
+	slot.Write("one", nil)
+	slot.Write("two", nil)
+
+	select {
+	case event := <-events:
+		if event != "a0012\n" {
+			t.Fatalf("the number of writes must be sent: %s", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event must be sent when the window closes")
+	}
+}
+
+func TestBroadcastSlotCoalesceConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "broadcast")
+	v.Set("coalesce_ms", 100)
+	v.Set("coalesce_mode", "count")
+
+	slot, err := GetSlot(v, nil, "001")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	if slot.(*broadcastSlot).coalesce != 100*time.Millisecond {
+		t.Fatalf("coalesce window must be 100ms")
+	}
+
+	v.Set("coalesce_mode", "first")
+	if _, err := GetSlot(v, nil, "001"); err == nil {
+		t.Fatalf("Slot must return error for an invalid coalesce mode")
+	}
+
+	v.Set("coalesce_mode", "latest")
+	v.Set("reliable", true)
+	if _, err := GetSlot(v, nil, "001"); err == nil {
+		t.Fatalf("Reliable slots must not coalesce events")
+	}
+}
+
+func TestBroadcastSlotReliableQueuedInOrder(t *testing.T) {
+	var mu sync.Mutex
+	queued := []string{}
+	manager := &MockConnectionManager{
+		ReceiversList: []string{"one"},
+		QueueFunc: func(id string, message string) {
+			mu.Lock()
+			queued = append(queued, message)
+			mu.Unlock()
+		},
+		SendFunc: func(id string, message string) error {
+			return nil
+		},
+	}
+	slot := newBroadcastSlot(make(map[string]string), manager, "001")
+	slot.reliable = true
+	slot.ackTimeout = 20 * time.Millisecond
+	slot.ackRetry = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slot.WriteAcknowledged("hello")
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queued) != 20 {
+		t.Fatalf("every event must be queued once: %d", len(queued))
+	}
+
+	for i, event := range queued {
+		if event != "a001"+strconv.Itoa(i+1)+"|hello\n" {
+			t.Fatalf("events must be queued in the order of their sequence: %v", queued)
+		}
+	}
+}
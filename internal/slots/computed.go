@@ -0,0 +1,117 @@
+package slots
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// computedSlot is a read only slot whose value is an expression over the
+// values of other slots, it is evaluated every time the slot is read.
+// Users need permission to read every slot in the expression.
+type computedSlot struct {
+	users   map[string]string
+	source  string
+	expr    expression
+	refs    []int
+	sources map[int]Peeker
+	checks  []Slot
+}
+
+func newComputedSlot(source string, users map[string]string) (*computedSlot, error) {
+	expr, refs, err := parseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression in computed slot: %w", err)
+	}
+
+	return &computedSlot{
+		users:  users,
+		source: source,
+		expr:   expr,
+		refs:   refs,
+	}, nil
+}
+
+// ResolveReferences sets the slots used by the expression of a computed
+// slot, the lookup returns the slot configured with a number. Only slots
+// that can be read without modifying them can be used in expressions.
+func ResolveReferences(slot Slot, lookup func(int) Slot) error {
+	computed, ok := slot.(*computedSlot)
+	if !ok {
+		return nil
+	}
+
+	sources := make(map[int]Peeker)
+	var checks []Slot
+	for _, id := range computed.refs {
+		source := lookup(id)
+		if source == nil {
+			return fmt.Errorf("slot %03d in expression is not configured", id)
+		}
+
+		peeker, ok := source.(Peeker)
+		if !ok {
+			return fmt.Errorf("slot %03d cannot be used in an expression", id)
+		}
+
+		if _, found := sources[id]; !found {
+			checks = append(checks, source)
+		}
+		sources[id] = peeker
+	}
+
+	computed.sources = sources
+	computed.checks = checks
+	return nil
+}
+
+func (m *computedSlot) Read() string {
+	value, err := m.expr.eval(func(id int) string {
+		source, ok := m.sources[id]
+		if !ok {
+			return ""
+		}
+		return source.Peek()
+	})
+	if err != nil {
+		slog.Debug("Error evaluating computed slot",
+			slog.String("expression", m.source),
+			slog.Any("error", err),
+		)
+		return ""
+	}
+
+	return value
+}
+
+func (m *computedSlot) Write(data string, from net.Conn) (string, error) {
+	return "", fmt.Errorf("computed slots cannot be written")
+}
+
+func (m *computedSlot) Info() []string {
+	return []string{
+		"kind=computed",
+		"expression=" + m.source,
+	}
+}
+
+// CanRead verifies the permissions of the slot and of every slot in the
+// expression, so the value does not reveal slots the user cannot read.
+func (m *computedSlot) CanRead(u *auth.User) bool {
+	if len(m.users) > 0 && m.users[u.Name] != "r" && m.users[u.Name] != "a" {
+		return false
+	}
+
+	for _, source := range m.checks {
+		if !source.CanRead(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *computedSlot) CanWrite(u *auth.User) bool {
+	return false
+}
@@ -0,0 +1,106 @@
+package slots
+
+import (
+	"testing"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+func loadComputedSlot(t *testing.T, expression string, sources map[int]Slot) *computedSlot {
+	t.Helper()
+
+	slot, err := newComputedSlot(expression, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	err = ResolveReferences(slot, func(id int) Slot { return sources[id] })
+	if err != nil {
+		t.Fatalf("References must be resolved: %s", err)
+	}
+	return slot
+}
+
+func TestComputedExpressions(t *testing.T) {
+	counter := &atomicSlot{users: map[string]string{}}
+	counter.Write("40", nil)
+	other := &atomicSlot{users: map[string]string{}}
+	other.Write("2", nil)
+	flag := newMemorySlot(map[string]string{}, 0, false, nil, "003")
+	sources := map[int]Slot{10: counter, 11: other, 3: flag}
+
+	tests := map[string]string{
+		`slot_010 + slot_011`:                     "42",
+		`slot_010 - slot_011 * 2`:                 "36",
+		`(slot_010 - slot_011) * 2`:               "76",
+		`slot_010 / 8`:                            "5",
+		`slot_010 % 7`:                            "5",
+		`-slot_011`:                               "-2",
+		`slot_003 == "" ? "free" : "busy"`:        "free",
+		`slot_010 > 10 && slot_011 < 10`:          "true",
+		`!(slot_010 > 10) || slot_003 != ""`:      "false",
+		`"node-" + slot_011`:                      "node-2",
+		`slot_010 >= 40 ? slot_010 : "too small"`: "40",
+		`slot_010 / (slot_011 - 2)`:               "",
+		`10 % 0.5`:                                "",
+		`10.9 % 3.5`:                              "1",
+	}
+
+	for expression, expected := range tests {
+		slot := loadComputedSlot(t, expression, sources)
+		if value := slot.Read(); value != expected {
+			t.Fatalf("%s must be %q, got %q", expression, expected, value)
+		}
+	}
+
+	// Reading the expression must not increment the counters
+	if counter.Peek() != "40" {
+		t.Fatalf("counters must not change when read in an expression: %s", counter.Peek())
+	}
+
+	flag.Write("busy", nil)
+	slot := loadComputedSlot(t, `slot_003 == "" ? "free" : "busy"`, sources)
+	if slot.Read() != "busy" {
+		t.Fatalf("the expression must be evaluated on every read")
+	}
+}
+
+func TestComputedInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"", "slot_010 +", "slot_01 + 1", `"open`, "slot_010 = 1", "(1", "1 ? 2", "node"} {
+		if _, err := newComputedSlot(expression, map[string]string{}); err == nil {
+			t.Fatalf("%q must be invalid", expression)
+		}
+	}
+
+	slot, _ := newComputedSlot("slot_010 + slot_011", map[string]string{})
+	bucket, _ := newTokenBucketSlot("hour", "interval", 2, 2, 1, map[string]string{})
+	sources := map[int]Slot{10: bucket}
+	if err := ResolveReferences(slot, func(id int) Slot { return sources[id] }); err == nil {
+		t.Fatalf("slots that change when read must not be used in expressions")
+	}
+
+	sources = map[int]Slot{10: &atomicSlot{}}
+	if err := ResolveReferences(slot, func(id int) Slot { return sources[id] }); err == nil {
+		t.Fatalf("missing slots must not be used in expressions")
+	}
+}
+
+func TestComputedPermissions(t *testing.T) {
+	open := newMemorySlot(map[string]string{}, 0, false, nil, "001")
+	private := newMemorySlot(map[string]string{"pepe": "r"}, 0, false, nil, "002")
+	slot := loadComputedSlot(t, "slot_001 + slot_002", map[int]Slot{1: open, 2: private})
+
+	pepe, _ := auth.GetUser("pepe", "pass")
+	bobby, _ := auth.GetUser("bobby", "pass")
+	if !slot.CanRead(&pepe) {
+		t.Fatalf("users that can read every slot must read the expression")
+	}
+
+	if slot.CanRead(&bobby) {
+		t.Fatalf("users that cannot read a slot must not read the expression")
+	}
+
+	if slot.CanWrite(&pepe) {
+		t.Fatalf("computed slots must not be written")
+	}
+}
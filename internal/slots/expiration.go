@@ -0,0 +1,51 @@
+package slots
+
+import (
+	"time"
+)
+
+// expiration keeps track of the time when the value of a slot expires.
+// It is not safe for concurrent use, slots must hold their own lock.
+type expiration struct {
+	defaultTTL time.Duration
+	expires    time.Time
+	timer      *time.Timer
+}
+
+func (e *expiration) expired() bool {
+	return !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+// remaining returns the time left until the value expires, zero means that
+// the value does not expire or that it has already expired.
+func (e *expiration) remaining() time.Duration {
+	if e.expires.IsZero() {
+		return 0
+	}
+
+	return max(0, time.Until(e.expires))
+}
+
+// set starts a new expiration period replacing the previous one, a ttl of zero
+// means that the value never expires. onExpire is called once the time is
+// reached with the expiration time it was set for, so it can be ignored if the
+// value was written again. Slots clear the value in onExpire, so the clients
+// waiting for changes see the expiration even if nobody reads the slot.
+func (e *expiration) set(ttl time.Duration, onExpire func(time.Time)) {
+	e.clear()
+	if ttl <= 0 {
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	e.expires = expires
+	e.timer = time.AfterFunc(ttl, func() { onExpire(expires) })
+}
+
+func (e *expiration) clear() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.expires = time.Time{}
+}
@@ -0,0 +1,371 @@
+package slots
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrDivisionByZero is returned when an expression divides by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// expression is a node of a parsed expression, it is evaluated with the
+// function that reads the value of the referenced slots. All the values are
+// text, arithmetic and ordering use them as numbers when they are numbers.
+type expression interface {
+	eval(read func(int) string) (string, error)
+}
+
+type literal struct {
+	value string
+}
+
+func (l literal) eval(func(int) string) (string, error) {
+	return l.value, nil
+}
+
+type slotRef struct {
+	id int
+}
+
+func (r slotRef) eval(read func(int) string) (string, error) {
+	return read(r.id), nil
+}
+
+type unary struct {
+	operator string
+	operand  expression
+}
+
+func (u unary) eval(read func(int) string) (string, error) {
+	value, err := u.operand.eval(read)
+	if err != nil {
+		return "", err
+	}
+
+	if u.operator == "!" {
+		return strconv.FormatBool(!truthy(value)), nil
+	}
+
+	number, ok := toNumber(value)
+	if !ok {
+		return "", fmt.Errorf("cannot negate %q", value)
+	}
+	return formatNumber(-number), nil
+}
+
+type binary struct {
+	operator    string
+	left, right expression
+}
+
+func (b binary) eval(read func(int) string) (string, error) {
+	left, err := b.left.eval(read)
+	if err != nil {
+		return "", err
+	}
+
+	// The logical operators only evaluate the right side when needed
+	switch b.operator {
+	case "&&":
+		if !truthy(left) {
+			return "false", nil
+		}
+	case "||":
+		if truthy(left) {
+			return "true", nil
+		}
+	}
+
+	right, err := b.right.eval(read)
+	if err != nil {
+		return "", err
+	}
+
+	switch b.operator {
+	case "&&", "||":
+		return strconv.FormatBool(truthy(right)), nil
+	case "==":
+		return strconv.FormatBool(compare(left, right) == 0), nil
+	case "!=":
+		return strconv.FormatBool(compare(left, right) != 0), nil
+	case "<":
+		return strconv.FormatBool(compare(left, right) < 0), nil
+	case "<=":
+		return strconv.FormatBool(compare(left, right) <= 0), nil
+	case ">":
+		return strconv.FormatBool(compare(left, right) > 0), nil
+	case ">=":
+		return strconv.FormatBool(compare(left, right) >= 0), nil
+	}
+
+	x, leftOk := toNumber(left)
+	y, rightOk := toNumber(right)
+	if !leftOk || !rightOk {
+		if b.operator == "+" {
+			// Adding text joins the values
+			return left + right, nil
+		}
+		return "", fmt.Errorf("cannot apply %s to %q and %q", b.operator, left, right)
+	}
+
+	switch b.operator {
+	case "+":
+		return formatNumber(x + y), nil
+	case "-":
+		return formatNumber(x - y), nil
+	case "*":
+		return formatNumber(x * y), nil
+	}
+
+	if y == 0 {
+		return "", ErrDivisionByZero
+	}
+
+	if b.operator == "/" {
+		return formatNumber(x / y), nil
+	}
+
+	// The remainder uses the integer part of the values, a divisor like 0.5
+	// is zero as well
+	if int64(y) == 0 {
+		return "", ErrDivisionByZero
+	}
+	return formatNumber(float64(int64(x) % int64(y))), nil
+}
+
+type conditional struct {
+	cond, then, otherwise expression
+}
+
+func (c conditional) eval(read func(int) string) (string, error) {
+	value, err := c.cond.eval(read)
+	if err != nil {
+		return "", err
+	}
+
+	if truthy(value) {
+		return c.then.eval(read)
+	}
+	return c.otherwise.eval(read)
+}
+
+func toNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	return number, err == nil
+}
+
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// truthy reports whether the value is true, empty values, zero and false
+// are false.
+func truthy(value string) bool {
+	if number, ok := toNumber(value); ok {
+		return number != 0
+	}
+
+	return value != "" && value != "false"
+}
+
+// compare compares the values as numbers when both are numbers, otherwise
+// they are compared as text.
+func compare(left, right string) int {
+	x, leftOk := toNumber(left)
+	y, rightOk := toNumber(right)
+	if leftOk && rightOk {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(left, right)
+}
+
+// parser reads an expression with the usual precedence of the operators:
+// the conditional operator, ||, &&, comparisons, + and -, * / and %, and
+// the unary operators. Slots are referenced by name, for example slot_010.
+type parser struct {
+	tokens []string
+	pos    int
+	refs   []int
+}
+
+// parseExpression parses the expression and returns the slots it references.
+func parseExpression(source string) (expression, []int, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.conditional()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+	return expr, p.refs, nil
+}
+
+// tokenize splits the expression in numbers, quoted text, names and operators.
+func tokenize(source string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated text in expression")
+			}
+			tokens = append(tokens, source[i:i+end+2])
+			i += end + 2
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, source[start:i])
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, source[start:i])
+		default:
+			operator := source[i : i+1]
+			if i+1 < len(source) && slices.Contains([]string{"==", "!=", "<=", ">=", "&&", "||"}, source[i:i+2]) {
+				operator = source[i : i+2]
+			} else if !strings.Contains("+-*/%<>!?:()", operator) {
+				return nil, fmt.Errorf("unexpected %q in expression", operator)
+			}
+			tokens = append(tokens, operator)
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *parser) conditional() (expression, error) {
+	cond, err := p.binary(0)
+	if err != nil || p.peek() != "?" {
+		return cond, err
+	}
+	p.next()
+
+	then, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.next() != ":" {
+		return nil, errors.New("missing : in conditional expression")
+	}
+
+	otherwise, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	return conditional{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// precedence lists the binary operators from the lowest to the highest precedence.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (expression, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for slices.Contains(precedence[level], p.peek()) {
+		operator := p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (expression, error) {
+	if p.peek() == "-" || p.peek() == "!" {
+		operator := p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{operator: operator, operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expression, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end of expression")
+	case token == "(":
+		expr, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing ) in expression")
+		}
+		return expr, nil
+	case token == "true" || token == "false":
+		return literal{value: token}, nil
+	case strings.HasPrefix(token, `"`):
+		return literal{value: strings.Trim(token, `"`)}, nil
+	case strings.HasPrefix(token, "slot_"):
+		id, err := strconv.Atoi(strings.TrimPrefix(token, "slot_"))
+		if err != nil || len(token) != 8 || id < 0 {
+			return nil, fmt.Errorf("invalid slot %q in expression", token)
+		}
+		p.refs = append(p.refs, id)
+		return slotRef{id: id}, nil
+	}
+
+	if _, ok := toNumber(token); ok {
+		return literal{value: token}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in expression", token)
+}
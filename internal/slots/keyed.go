@@ -0,0 +1,189 @@
+package slots
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// ErrMissingKey is returned when a keyed slot is used without a key.
+var ErrMissingKey = errors.New("key must be set for keyed slots")
+
+// keyedEntry is the limiter of a single key.
+type keyedEntry struct {
+	key  string
+	slot Slot
+	used time.Time
+}
+
+// keyedSlot keeps an independent limiter for every key, the limiters are
+// created the first time a key is used. When there are too many keys the
+// least recently used one is removed, keys that are not used for the idle
+// time are removed too.
+type keyedSlot struct {
+	users    map[string]string
+	kind     string
+	create   func() (Slot, error)
+	keys     map[string]*list.Element
+	lru      *list.List
+	maxKeys  int
+	idle     time.Duration
+	parent   limiter
+	parentID string
+	shadow   *shadowMode
+	mu       sync.Mutex
+}
+
+func newKeyedSlot(kind string, maxKeys, idle int, users map[string]string, create func() (Slot, error)) (*keyedSlot, error) {
+	if maxKeys < 1 {
+		return nil, fmt.Errorf("max_keys must be bigger than zero")
+	}
+
+	if idle < 0 {
+		return nil, fmt.Errorf("key_idle cannot be negative")
+	}
+
+	// Validate the limiter configuration before any key is used
+	if _, err := create(); err != nil {
+		return nil, err
+	}
+
+	return &keyedSlot{
+		users:   users,
+		kind:    kind,
+		create:  create,
+		keys:    make(map[string]*list.Element),
+		lru:     list.New(),
+		maxKeys: maxKeys,
+		idle:    time.Duration(idle) * time.Second,
+	}, nil
+}
+
+// Key returns the limiter of the key, creating it if it does not exist.
+func (m *keyedSlot) Key(key string) (Slot, error) {
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+
+	timeNow := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeIdle(timeNow)
+
+	if element, ok := m.keys[key]; ok {
+		entry := element.Value.(*keyedEntry)
+		entry.used = timeNow
+		m.lru.MoveToFront(element)
+		return entry.slot, nil
+	}
+
+	if m.lru.Len() >= m.maxKeys {
+		m.remove(m.lru.Back())
+	}
+
+	slot, err := m.create()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.parent != nil {
+		slot.(parented).setParent(m.parent, m.parentID)
+	}
+
+	m.keys[key] = m.lru.PushFront(&keyedEntry{key: key, slot: slot, used: timeNow})
+	return slot, nil
+}
+
+// removeIdle removes the keys that were not used for the idle time,
+// it must be called holding the lock.
+func (m *keyedSlot) removeIdle(timeNow time.Time) {
+	if m.idle == 0 {
+		return
+	}
+
+	for element := m.lru.Back(); element != nil; element = m.lru.Back() {
+		if timeNow.Sub(element.Value.(*keyedEntry).used) < m.idle {
+			return
+		}
+		m.remove(element)
+	}
+}
+
+func (m *keyedSlot) remove(element *list.Element) {
+	entry := m.lru.Remove(element).(*keyedEntry)
+	delete(m.keys, entry.key)
+}
+
+// setParent sets the parent of the limiters of every key, including the
+// keys that already exist.
+func (m *keyedSlot) setParent(parent limiter, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parent = parent
+	m.parentID = id
+	for element := m.lru.Front(); element != nil; element = element.Next() {
+		element.Value.(*keyedEntry).slot.(parented).setParent(parent, id)
+	}
+}
+
+func (m *keyedSlot) parentLimiter() limiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.parent
+}
+
+// Read returns an empty value, keyed slots can only be read with a key.
+func (m *keyedSlot) Read() string {
+	return ""
+}
+
+func (m *keyedSlot) Write(data string, from net.Conn) (string, error) {
+	return "", fmt.Errorf("keyed slots cannot be used to write")
+}
+
+// Reset removes all the keys, the limiters are created again when used.
+func (m *keyedSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = make(map[string]*list.Element)
+	m.lru.Init()
+	return ""
+}
+
+func (m *keyedSlot) Info() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeIdle(time.Now())
+	return append([]string{
+		"kind=" + m.kind,
+		"keyed=true",
+		"keys=" + strconv.Itoa(m.lru.Len()),
+		"max_keys=" + strconv.Itoa(m.maxKeys),
+		"key_idle=" + strconv.FormatInt(int64(m.idle/time.Second), 10),
+		"parent=" + m.parentID,
+	}, m.shadow.info()...)
+}
+
+func (m *keyedSlot) CanRead(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "r" || m.users[u.Name] == "a"
+}
+
+func (m *keyedSlot) CanWrite(u *auth.User) bool {
+	return false
+}
@@ -0,0 +1,117 @@
+package slots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func loadKeyedSlot(t *testing.T, maxKeys, idle int) *keyedSlot {
+	v := viper.New()
+
+	v.Set("kind", "token_bucket")
+	v.Set("bucket_size", 1)
+	v.Set("period", "hour")
+	v.Set("keyed", true)
+	v.Set("max_keys", maxKeys)
+	v.Set("key_idle", idle)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	return slot.(*keyedSlot)
+}
+
+func readKey(t *testing.T, slot Keyed, key string) string {
+	keySlot, err := slot.Key(key)
+	if err != nil {
+		t.Fatalf("error selecting key: %s", err)
+	}
+	return keySlot.Read()
+}
+
+func TestKeyedIndependentKeys(t *testing.T) {
+	slot := loadKeyedSlot(t, 10, 0)
+
+	if readKey(t, slot, "one") != "1" {
+		t.Fatalf("first read of a key must return a token")
+	}
+
+	if readKey(t, slot, "one") != "0" {
+		t.Fatalf("bucket of the key must be empty")
+	}
+
+	if readKey(t, slot, "two") != "1" {
+		t.Fatalf("every key must have its own bucket")
+	}
+
+	if _, err := slot.Key(""); err != ErrMissingKey {
+		t.Fatalf("empty key must return error: %v", err)
+	}
+}
+
+func TestKeyedLRUEviction(t *testing.T) {
+	slot := loadKeyedSlot(t, 2, 0)
+
+	readKey(t, slot, "one")
+	readKey(t, slot, "two")
+	// Using the first key makes the second one the least recently used
+	readKey(t, slot, "one")
+	readKey(t, slot, "three")
+
+	if len(slot.keys) != 2 {
+		t.Fatalf("number of keys must be capped: %d", len(slot.keys))
+	}
+
+	if _, ok := slot.keys["two"]; ok {
+		t.Fatalf("least recently used key must be removed")
+	}
+
+	if readKey(t, slot, "one") != "0" {
+		t.Fatalf("recently used key must be kept")
+	}
+}
+
+func TestKeyedIdleExpiry(t *testing.T) {
+	slot := loadKeyedSlot(t, 10, 1)
+
+	readKey(t, slot, "one")
+	time.Sleep(1100 * time.Millisecond)
+
+	if readKey(t, slot, "one") != "1" {
+		t.Fatalf("idle key must be created again")
+	}
+}
+
+func TestKeyedReset(t *testing.T) {
+	slot := loadKeyedSlot(t, 10, 0)
+
+	readKey(t, slot, "one")
+	slot.Reset()
+
+	if readKey(t, slot, "one") != "1" {
+		t.Fatalf("reset must remove all the keys")
+	}
+}
+
+func TestKeyedInvalidConfig(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "leaky_bucket")
+	v.Set("bucket_size", 0)
+	v.Set("keyed", true)
+
+	_, err := GetSlot(v, nil, "")
+	if err == nil {
+		t.Fatalf("Slot must validate the limiter configuration")
+	}
+
+	v.Set("bucket_size", 10)
+	v.Set("max_keys", 0)
+	_, err = GetSlot(v, nil, "")
+	if err == nil {
+		t.Fatalf("Slot must return error for zero max_keys")
+	}
+}
@@ -3,6 +3,7 @@ package slots
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -10,12 +11,18 @@ import (
 )
 
 type leakyBucketSlot struct {
-	users  map[string]string
-	value  int64
-	size   int64
-	rate   int
-	window int64
-	mu     sync.Mutex
+	users    map[string]string
+	value    int64
+	size     int64
+	rate     int
+	window   int64
+	parent   limiter
+	parentID string
+	shadow   *shadowMode
+	queue    bool
+	notifier *notifier
+	taken    int64
+	mu       sync.Mutex
 }
 
 func newLeakyBucketSlot(bucketSize, refreshRate int, users map[string]string) (*leakyBucketSlot, error) {
@@ -34,10 +41,9 @@ func currentWindowMillis(rate int) int64 {
 	return time.Now().UnixMilli() / int64(rate)
 }
 
-func (m *leakyBucketSlot) Read() string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// leak removes the tokens leaked since the last call,
+// it must be called holding the lock.
+func (m *leakyBucketSlot) leak() {
 	current := currentWindowMillis(m.rate)
 	windowDiff := current - m.window
 	if windowDiff > m.size {
@@ -47,12 +53,190 @@ func (m *leakyBucketSlot) Read() string {
 		m.window = current
 		m.value = max(0, m.value-windowDiff)
 	}
+}
+
+func (m *leakyBucketSlot) Read() string {
+	response, _ := m.Allow()
+	return response
+}
+
+// Allow adds the request to the bucket, on queueing buckets the response is
+// the delay of the request.
+func (m *leakyBucketSlot) Allow() (string, bool) {
+	if m.queue {
+		delay := m.enqueue()
+		return strconv.FormatInt(delay, 10), delay >= 0
+	}
+
+	granted := m.takeTokens(1, false, true)
+	return strconv.Itoa(granted), granted > 0
+}
+
+// enqueue admits the request in the bucket and returns the milliseconds the
+// caller must wait until its token leaks, or -1 when the bucket is full.
+func (m *leakyBucketSlot) enqueue() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leak()
+	admitted := m.value < m.size
+	if admitted && m.parent != nil {
+		admitted = m.parent.take(1, false) == 1
+	}
+
+	if m.shadow != nil {
+		// Shadow slots do not delay nor reject requests
+		if !admitted {
+			m.shadow.deny()
+		} else {
+			m.fill(1)
+			m.taken++
+		}
+		return 0
+	}
 
-	if m.value == m.size {
-		return "0"
+	if !admitted {
+		return -1
+	}
+
+	delay := m.delay()
+	m.fill(1)
+	m.taken++
+	return delay
+}
+
+// delay returns the milliseconds until all the tokens in the bucket leak,
+// it must be called holding the lock.
+func (m *leakyBucketSlot) delay() int64 {
+	if m.value == 0 {
+		return 0
+	}
+
+	nextLeak := (m.window+1)*int64(m.rate) - time.Now().UnixMilli()
+	return max(0, nextLeak) + (m.value-1)*int64(m.rate)
+}
+
+func (m *leakyBucketSlot) take(tokens int, partial bool) int {
+	return m.takeTokens(tokens, partial, false)
+}
+
+// takeTokens adds the tokens to the bucket and its parents, the tokens
+// added by the clients of the slot are counted so they can be removed when
+// a batch is rolled back. Shadow slots allow the whole request and count it
+// as denied when not all the tokens could be added.
+func (m *leakyBucketSlot) takeTokens(tokens int, partial bool, direct bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leak()
+	room := int(m.size - m.value)
+	granted := tokens
+	if partial {
+		granted = min(tokens, room)
+	} else if room < tokens {
+		granted = 0
+	}
+
+	if m.parent != nil && granted > 0 {
+		granted = m.parent.take(granted, partial)
+	}
+
+	m.fill(granted)
+	if direct {
+		m.taken += int64(granted)
+	}
+	if granted < tokens && m.shadow != nil {
+		m.shadow.deny()
+		return tokens
 	}
-	m.value = min(m.size, m.value+1)
-	return "1"
+	return granted
+}
+
+// fill adds the tokens to the bucket and notifies when it becomes full,
+// it must be called holding the lock.
+func (m *leakyBucketSlot) fill(tokens int) {
+	m.value += int64(tokens)
+	if tokens > 0 && m.value == m.size {
+		m.notifier.notify("full", "")
+	}
+}
+
+func (m *leakyBucketSlot) refund(tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leak()
+	m.value = max(0, m.value-int64(tokens))
+	if m.parent != nil {
+		m.parent.refund(tokens)
+	}
+}
+
+func (m *leakyBucketSlot) setParent(parent limiter, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parent = parent
+	m.parentID = id
+}
+
+func (m *leakyBucketSlot) parentLimiter() limiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.parent
+}
+
+// Save returns a function that commits the requests added by the clients
+// of the slot since it was called, or removes them from the bucket.
+func (m *leakyBucketSlot) Save() func(bool) {
+	m.mu.Lock()
+	taken := m.taken
+	m.notifier.hold()
+	m.mu.Unlock()
+
+	return func(commit bool) {
+		m.mu.Lock()
+		m.notifier.release(commit)
+		if commit {
+			m.mu.Unlock()
+			return
+		}
+
+		diff := m.taken - taken
+		m.taken = taken
+		m.mu.Unlock()
+
+		if diff > 0 {
+			m.refund(int(diff))
+		}
+	}
+}
+
+// Reset empties the bucket.
+func (m *leakyBucketSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.window = currentWindowMillis(m.rate)
+	m.value = 0
+	return strconv.FormatInt(m.value, 10)
+}
+
+func (m *leakyBucketSlot) Info() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leak()
+	return append([]string{
+		"kind=leaky_bucket",
+		"bucket_size=" + strconv.FormatInt(m.size, 10),
+		"refresh_rate=" + strconv.Itoa(m.rate),
+		"level=" + strconv.FormatInt(m.value, 10),
+		"parent=" + m.parentID,
+		"queue=" + strconv.FormatBool(m.queue),
+		"notify=" + strconv.FormatBool(m.notifier.enabled()),
+	}, m.shadow.info()...)
 }
 
 func (m *leakyBucketSlot) CanRead(u *auth.User) bool {
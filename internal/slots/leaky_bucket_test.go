@@ -1,6 +1,7 @@
 package slots
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -167,3 +168,59 @@ func TestLeakyBucketCanReadWhenUsersEmpty(t *testing.T) {
 		t.Fatalf("we should be able to read when users map is empty")
 	}
 }
+
+func TestLeakyBucketShadow(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "leaky_bucket")
+	v.Set("bucket_size", 1)
+	v.Set("refresh_rate", 100000)
+	v.Set("shadow", true)
+
+	slot, err := GetSlot(v, nil, "003")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	slot.Read()
+	if slot.Read() != "1" {
+		t.Fatalf("shadow slots must allow every request")
+	}
+
+	info := slot.(Inspector).Info()
+	if info[len(info)-1] != "shadow_denied=1" {
+		t.Fatalf("denied requests must be counted: %v", info)
+	}
+}
+
+func TestLeakyBucketQueue(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "leaky_bucket")
+	v.Set("bucket_size", 3)
+	v.Set("refresh_rate", 100)
+	v.Set("queue", true)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	if slot.Read() != "0" {
+		t.Fatalf("first request must not wait")
+	}
+
+	delay, _ := strconv.Atoi(slot.Read())
+	if delay < 0 || delay > 100 {
+		t.Fatalf("second request must wait until the next leak: %d", delay)
+	}
+
+	next, _ := strconv.Atoi(slot.Read())
+	if next != delay+100 {
+		t.Fatalf("third request must wait one more leak: %d %d", delay, next)
+	}
+
+	if slot.Read() != "-1" {
+		t.Fatalf("requests must be rejected when the queue is full")
+	}
+}
@@ -0,0 +1,221 @@
+package slots
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// ErrMapFull is returned when a new key is written on a map slot that
+// already has the maximum number of keys.
+var ErrMapFull = errors.New("map slot has too many keys")
+
+// mapEntry is the value of a key, a zero expiration time means that the
+// value never expires.
+type mapEntry struct {
+	value   string
+	expires time.Time
+}
+
+func (e mapEntry) expired(timeNow time.Time) bool {
+	return !e.expires.IsZero() && timeNow.After(e.expires)
+}
+
+// mapSlot stores values by key, every value can expire independently.
+// Expired keys are removed when they are found or when the slot is full.
+type mapSlot struct {
+	users      map[string]string
+	entries    map[string]mapEntry
+	maxKeys    int
+	defaultTTL time.Duration
+	mu         sync.Mutex
+}
+
+func newMapSlot(maxKeys int, defaultTTL int, users map[string]string) (*mapSlot, error) {
+	if maxKeys < 1 {
+		return nil, fmt.Errorf("max_keys must be bigger than zero")
+	}
+
+	return &mapSlot{
+		users:      users,
+		entries:    make(map[string]mapEntry),
+		maxKeys:    maxKeys,
+		defaultTTL: time.Duration(defaultTTL) * time.Second,
+	}, nil
+}
+
+// Key returns the slot to read the value of the key.
+func (m *mapSlot) Key(key string) (Slot, error) {
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+
+	return &mapKey{slot: m, key: key}, nil
+}
+
+// get returns the value of the key, it must be called holding the lock.
+func (m *mapSlot) get(key string, timeNow time.Time) (string, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	if entry.expired(timeNow) {
+		delete(m.entries, key)
+		return "", false
+	}
+
+	return entry.value, true
+}
+
+// removeExpired removes all the expired keys, it must be called holding the lock.
+func (m *mapSlot) removeExpired(timeNow time.Time) {
+	for key, entry := range m.entries {
+		if entry.expired(timeNow) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+// Read returns an empty value, map slots can only be read with a key.
+func (m *mapSlot) Read() string {
+	return ""
+}
+
+// Write sets the value of a key, the data contains the key and the value
+// separated by a pipe.
+func (m *mapSlot) Write(data string, from net.Conn) (string, error) {
+	return m.WriteWithTTL(data, m.defaultTTL, from)
+}
+
+func (m *mapSlot) WriteWithTTL(data string, ttl time.Duration, from net.Conn) (string, error) {
+	key, value, found := strings.Cut(data, "|")
+	if !found || key == "" {
+		return "", ErrMissingKey
+	}
+
+	timeNow := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.maxKeys {
+		m.removeExpired(timeNow)
+		if len(m.entries) >= m.maxKeys {
+			return "", ErrMapFull
+		}
+	}
+
+	entry := mapEntry{value: value}
+	if ttl > 0 {
+		entry.expires = timeNow.Add(ttl)
+	}
+	m.entries[key] = entry
+	return value, nil
+}
+
+// Remove deletes the key and reports whether it existed.
+func (m *mapSlot) Remove(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.get(key, time.Now())
+	delete(m.entries, key)
+	return ok
+}
+
+// List returns the keys in order after the given one, up to the limit.
+func (m *mapSlot) List(after string, limit int) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired(time.Now())
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		if key > after {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+	return keys[:min(limit, len(keys))]
+}
+
+func (m *mapSlot) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired(time.Now())
+	return len(m.entries)
+}
+
+// Reset removes all the keys.
+func (m *mapSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = make(map[string]mapEntry)
+	return ""
+}
+
+func (m *mapSlot) Info() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired(time.Now())
+	return []string{
+		"kind=map",
+		"keys=" + strconv.Itoa(len(m.entries)),
+		"max_keys=" + strconv.Itoa(m.maxKeys),
+		"default_ttl=" + strconv.FormatInt(int64(m.defaultTTL/time.Second), 10),
+	}
+}
+
+func (m *mapSlot) CanRead(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "r" || m.users[u.Name] == "a"
+}
+
+func (m *mapSlot) CanWrite(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "w" || m.users[u.Name] == "a"
+}
+
+// mapKey reads and writes a single key of a map slot.
+type mapKey struct {
+	slot *mapSlot
+	key  string
+}
+
+func (k *mapKey) Read() string {
+	k.slot.mu.Lock()
+	defer k.slot.mu.Unlock()
+
+	value, _ := k.slot.get(k.key, time.Now())
+	return value
+}
+
+func (k *mapKey) Write(data string, from net.Conn) (string, error) {
+	return k.slot.Write(k.key+"|"+data, from)
+}
+
+func (k *mapKey) CanRead(u *auth.User) bool {
+	return k.slot.CanRead(u)
+}
+
+func (k *mapKey) CanWrite(u *auth.User) bool {
+	return k.slot.CanWrite(u)
+}
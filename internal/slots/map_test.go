@@ -0,0 +1,112 @@
+package slots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func loadMapSlot(t *testing.T, maxKeys int) *mapSlot {
+	slot, err := newMapSlot(maxKeys, 0, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	return slot
+}
+
+func TestMapSetAndGet(t *testing.T) {
+	slot := loadMapSlot(t, 10)
+
+	value, err := slot.Write("color|blue", nil)
+	if err != nil || value != "blue" {
+		t.Fatalf("unexpected write result: %s %v", value, err)
+	}
+	slot.Write("size|10", nil)
+
+	if readKey(t, slot, "color") != "blue" || readKey(t, slot, "size") != "10" {
+		t.Fatalf("keys must keep their values")
+	}
+
+	if readKey(t, slot, "missing") != "" {
+		t.Fatalf("missing keys must be empty")
+	}
+
+	if _, err := slot.Write("novalue", nil); err == nil {
+		t.Fatalf("writes without a key must fail")
+	}
+
+	if _, err := slot.Key(""); err == nil {
+		t.Fatalf("reads without a key must fail")
+	}
+}
+
+func TestMapRemoveListAndSize(t *testing.T) {
+	slot := loadMapSlot(t, 10)
+	for _, key := range []string{"c", "a", "d", "b"} {
+		slot.Write(key+"|"+key, nil)
+	}
+
+	if slot.Size() != 4 {
+		t.Fatalf("Size should be 4, got %d", slot.Size())
+	}
+
+	if !slot.Remove("d") || slot.Remove("d") {
+		t.Fatalf("Remove must report whether the key existed")
+	}
+
+	keys := slot.List("", 2)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("keys must be listed in order: %v", keys)
+	}
+
+	keys = slot.List("b", 2)
+	if len(keys) != 1 || keys[0] != "c" {
+		t.Fatalf("the next page must start after the last key: %v", keys)
+	}
+}
+
+func TestMapTTL(t *testing.T) {
+	slot := loadMapSlot(t, 2)
+
+	slot.WriteWithTTL("short|1", 20*time.Millisecond, nil)
+	slot.Write("long|2", nil)
+
+	if _, err := slot.Write("other|3", nil); err != ErrMapFull {
+		t.Fatalf("writes must fail when the map is full: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if readKey(t, slot, "short") != "" {
+		t.Fatalf("expired keys must be empty")
+	}
+
+	if _, err := slot.Write("other|3", nil); err != nil {
+		t.Fatalf("expired keys must not count for the limit: %v", err)
+	}
+
+	if slot.Size() != 2 {
+		t.Fatalf("Size should be 2, got %d", slot.Size())
+	}
+}
+
+func TestMapConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "map")
+	v.Set("default_ttl", 60)
+
+	slot, err := GetSlot(v, nil, "000")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	info := slot.(*mapSlot).Info()
+	if info[0] != "kind=map" || info[2] != "max_keys=1000" || info[3] != "default_ttl=60" {
+		t.Fatalf("unexpected info: %v", info)
+	}
+
+	v.Set("max_keys", 0)
+	if _, err := GetSlot(v, nil, "000"); err == nil {
+		t.Fatalf("Slot must return error when max_keys is zero")
+	}
+}
@@ -2,21 +2,68 @@ package slots
 
 import (
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
 )
 
 type memorySlot struct {
-	users map[string]string
-	value string
-	mu    sync.RWMutex
+	users       map[string]string
+	value       string
+	slotID      string
+	expiration  expiration
+	expireEvent bool
+	manager     connectionmanager.ConnectionManager
+	notifier    *notifier
+	versions    versions
+	mu          sync.RWMutex
+}
+
+func newMemorySlot(users map[string]string, defaultTTL int, expireEvent bool, conn connectionmanager.ConnectionManager, id string) *memorySlot {
+	return &memorySlot{
+		users:       users,
+		value:       "",
+		slotID:      id,
+		manager:     conn,
+		expiration:  expiration{defaultTTL: time.Duration(defaultTTL) * time.Second},
+		expireEvent: expireEvent,
+	}
 }
 
 func (m *memorySlot) Read() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.current()
+}
+
+// Peek returns the value without the changes of a batch that is running.
+func (m *memorySlot) Peek() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.versions.visible(m.current())
+}
+
+func (m *memorySlot) Since(version uint64) (uint64, string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number, changed := m.versions.since(version)
+	return number, m.versions.visible(m.current()), changed
+}
+
+// current returns the value unless it has expired,
+// it must be called holding the lock.
+func (m *memorySlot) current() string {
+	if m.expiration.expired() {
+		return ""
+	}
+
 	return m.value
 }
 
@@ -37,9 +84,127 @@ func (m *memorySlot) CanWrite(u *auth.User) bool {
 }
 
 func (m *memorySlot) Write(data string, from net.Conn) (string, error) {
+	return m.WriteWithTTL(data, m.expiration.defaultTTL, from)
+}
+
+func (m *memorySlot) WriteWithTTL(data string, ttl time.Duration, from net.Conn) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value = data
+	m.versions.bump()
+	m.expiration.set(ttl, m.expire)
+	m.notifier.notify("write", m.value)
+	return m.value, nil
+}
+
+// expire clears the value and notifies the clients that it expired.
+func (m *memorySlot) expire(expires time.Time) {
+	m.mu.Lock()
+	if !m.expiration.expires.Equal(expires) {
+		m.mu.Unlock()
+		return
+	}
+	m.value = ""
+	m.versions.bump()
+	m.expiration.clear()
+	m.notifier.notify("expire", "")
+	m.mu.Unlock()
+
+	if !m.expireEvent {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("a")
+	sb.WriteString(m.slotID)
+	sb.WriteString("\n")
+	m.manager.Broadcast(m.slotID, sb.String(), m.CanRead)
+}
+
+func (m *memorySlot) CompareAndSwap(expected string, data string, caller Caller) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.current() != expected {
+		return "", ErrValueMismatch
+	}
+
 	m.value = data
+	m.versions.bump()
+	m.expiration.set(m.expiration.defaultTTL, m.expire)
+	m.notifier.notify("write", m.value)
 	return m.value, nil
 }
+
+// Save returns a function that commits or restores the value and the
+// expiration of the slot, a value that expired in the meantime is cleared
+// and notified.
+func (m *memorySlot) Save() func(bool) {
+	m.mu.Lock()
+	value := m.value
+	visible := m.current()
+	expires := m.expiration.expires
+	m.versions.hold(visible)
+	m.notifier.hold()
+	m.mu.Unlock()
+
+	return func(commit bool) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if commit {
+			m.versions.release(true)
+			m.notifier.release(true)
+			return
+		}
+
+		defer func() {
+			changed := m.current() != visible
+			m.versions.release(changed)
+			m.notifier.release(false)
+			if changed {
+				m.notifier.notify("write", m.value)
+			}
+		}()
+
+		if m.value == value && m.expiration.expires.Equal(expires) {
+			return
+		}
+
+		m.value = value
+		m.expiration.clear()
+		if !expires.IsZero() {
+			m.expiration.set(time.Until(expires), m.expire)
+			if m.expiration.expires.IsZero() {
+				m.value = ""
+			}
+		}
+		m.versions.bump()
+		m.notifier.notify("write", m.value)
+	}
+}
+
+func (m *memorySlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value = ""
+	m.versions.bump()
+	m.expiration.clear()
+	m.notifier.notify("reset", "")
+	return m.value
+}
+
+func (m *memorySlot) Info() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return []string{
+		"kind=simple_memory",
+		"default_ttl=" + strconv.FormatInt(int64(m.expiration.defaultTTL/time.Second), 10),
+		"expire_event=" + strconv.FormatBool(m.expireEvent),
+		"ttl_ms=" + strconv.FormatInt(m.expiration.remaining().Milliseconds(), 10),
+		"notify=" + strconv.FormatBool(m.notifier.enabled()),
+	}
+}
@@ -0,0 +1,163 @@
+package slots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestMemoryReadAndWrite(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "simple_memory")
+
+	slot, err := GetSlot(v, nil, "000")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	slot.Write("hello", nil)
+	if slot.Read() != "hello" {
+		t.Fatalf("Value should be 'hello'")
+	}
+}
+
+func TestMemoryWriteWithTTL(t *testing.T) {
+	slot := newMemorySlot(map[string]string{}, 0, false, nil, "000")
+
+	slot.WriteWithTTL("flag", 50*time.Millisecond, nil)
+	if slot.Read() != "flag" {
+		t.Fatalf("Value should be 'flag' before it expires")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if slot.Read() != "" {
+		t.Fatalf("Value should be empty after it expires")
+	}
+}
+
+func TestMemoryDefaultTTL(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "simple_memory")
+	v.Set("default_ttl", 1)
+
+	slot, err := GetSlot(v, nil, "000")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	slot.Write("flag", nil)
+	if slot.(*memorySlot).expiration.remaining() <= 0 {
+		t.Fatalf("Value must expire with the default ttl")
+	}
+
+	// An explicit ttl of zero never expires
+	slot.(Expirer).WriteWithTTL("forever", 0, nil)
+	if slot.(*memorySlot).expiration.remaining() != 0 {
+		t.Fatalf("Value must not expire with a zero ttl")
+	}
+}
+
+func TestMemoryNegativeDefaultTTL(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "simple_memory")
+	v.Set("default_ttl", -1)
+
+	_, err := GetSlot(v, nil, "000")
+	if err == nil {
+		t.Fatalf("Slot must return error with negative default_ttl")
+	}
+}
+
+func TestMemoryExpireEvent(t *testing.T) {
+	events := make(chan string, 1)
+	manager := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events <- message
+			return "", nil
+		},
+	}
+	slot := newMemorySlot(map[string]string{}, 0, true, manager, "007")
+
+	slot.WriteWithTTL("flag", 20*time.Millisecond, nil)
+
+	select {
+	case event := <-events:
+		if event != "a007\n" {
+			t.Fatalf("unexpected expiry event: %q", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expiry event was not broadcasted")
+	}
+}
+
+func TestMemoryExpireEventOverwritten(t *testing.T) {
+	events := make(chan string, 1)
+	manager := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events <- message
+			return "", nil
+		},
+	}
+	slot := newMemorySlot(map[string]string{}, 0, true, manager, "007")
+
+	slot.WriteWithTTL("flag", 20*time.Millisecond, nil)
+	slot.Write("stays", nil)
+
+	select {
+	case event := <-events:
+		t.Fatalf("overwritten value must not expire: %q", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if slot.Read() != "stays" {
+		t.Fatalf("Value should be 'stays'")
+	}
+}
+
+func TestMemoryCompareAndSwap(t *testing.T) {
+	slot := newMemorySlot(map[string]string{}, 0, false, nil, "000")
+
+	if _, err := slot.CompareAndSwap("", "first", Caller{}); err != nil {
+		t.Fatalf("compare with the empty value must succeed: %s", err)
+	}
+
+	if _, err := slot.CompareAndSwap("other", "second", Caller{}); err != ErrValueMismatch {
+		t.Fatalf("compare with a different value must fail: %v", err)
+	}
+
+	if slot.Read() != "first" {
+		t.Fatalf("Value should be 'first'")
+	}
+}
+
+func TestMemorySave(t *testing.T) {
+	slot := newMemorySlot(map[string]string{}, 0, false, nil, "000")
+	slot.WriteWithTTL("first", time.Hour, nil)
+
+	restore := slot.Save()
+	slot.Write("second", nil)
+	restore(false)
+
+	if slot.Read() != "first" || slot.expiration.remaining() == 0 {
+		t.Fatalf("the value and its expiration must be restored: %s", slot.Read())
+	}
+
+	version, _, _ := slot.Since(0)
+	if version != 1 {
+		t.Fatalf("a rolled back batch must not change the version: %d", version)
+	}
+
+	commit := slot.Save()
+	slot.Write("second", nil)
+	slot.Write("third", nil)
+	if slot.Peek() != "first" {
+		t.Fatalf("the changes must not be visible before the commit: %s", slot.Peek())
+	}
+
+	commit(true)
+	version, value, _ := slot.Since(0)
+	if version != 2 || value != "third" {
+		t.Fatalf("the commit must count as a single change: %d %s", version, value)
+	}
+}
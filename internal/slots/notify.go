@@ -0,0 +1,107 @@
+package slots
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
+)
+
+// notifier sends the change events of a slot to the clients subscribed to
+// it. The events are queued and sent in order by a single goroutine, so the
+// slots can notify while holding their lock. The events held while a batch
+// runs are protected by the lock of the slot.
+type notifier struct {
+	manager connectionmanager.ConnectionManager
+	slotID  string
+	canRead connectionmanager.ReadChecker
+	events  chan string
+	held    bool
+	pending []string
+}
+
+func newNotifier(manager connectionmanager.ConnectionManager, id string, canRead connectionmanager.ReadChecker) *notifier {
+	n := &notifier{
+		manager: manager,
+		slotID:  id,
+		canRead: canRead,
+		events:  make(chan string, 128),
+	}
+
+	go n.run()
+	return n
+}
+
+func (n *notifier) run() {
+	for event := range n.events {
+		n.manager.Broadcast(n.slotID, event, n.canRead)
+	}
+}
+
+// notify queues the event with its data (a000<event>|<data>), events are
+// dropped when the queue is full.
+func (n *notifier) notify(event string, data string) {
+	if n == nil {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("a")
+	sb.WriteString(n.slotID)
+	sb.WriteString(event)
+	sb.WriteString("|")
+	sb.WriteString(data)
+	sb.WriteString("\n")
+
+	if n.held {
+		n.pending = append(n.pending, sb.String())
+		return
+	}
+	n.send(sb.String())
+}
+
+// send queues an event, it is dropped when the queue is full.
+func (n *notifier) send(event string) {
+	select {
+	case n.events <- event:
+	default:
+		slog.Debug("Dropping change event of slot",
+			slog.String("slot", n.slotID),
+			slog.String("event", event),
+		)
+	}
+}
+
+// hold keeps the events until release, so the events of a batch that is
+// rolled back are never sent.
+func (n *notifier) hold() {
+	if n == nil {
+		return
+	}
+
+	n.held = true
+}
+
+// release stops holding the events, they are sent in order when they are
+// committed and dropped otherwise.
+func (n *notifier) release(commit bool) {
+	if n == nil {
+		return
+	}
+
+	pending := n.pending
+	n.held = false
+	n.pending = nil
+	if !commit {
+		return
+	}
+
+	for _, event := range pending {
+		n.send(event)
+	}
+}
+
+// enabled reports whether the slot sends change events.
+func (n *notifier) enabled() bool {
+	return n != nil
+}
@@ -0,0 +1,139 @@
+package slots
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// notifyManager returns a manager that sends the broadcasted events to the channel.
+func notifyManager(events chan string) *MockConnectionManager {
+	return &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events <- message
+			return "mock response", nil
+		},
+	}
+}
+
+func expectEvent(t *testing.T, events chan string, expected string) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event != expected {
+			t.Fatalf("expected event %q, got %q", expected, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for event %q", expected)
+	}
+}
+
+func TestNotifyMemory(t *testing.T) {
+	events := make(chan string, 10)
+	v := viper.New()
+	v.Set("kind", "simple_memory")
+	v.Set("notify", true)
+
+	slot, err := GetSlot(v, notifyManager(events), "001")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	slot.Write("hello", nil)
+	expectEvent(t, events, "a001write|hello\n")
+
+	slot.(*memorySlot).WriteWithTTL("short", 20*time.Millisecond, nil)
+	expectEvent(t, events, "a001write|short\n")
+	expectEvent(t, events, "a001expire|\n")
+
+	slot.(*memorySlot).Reset()
+	expectEvent(t, events, "a001reset|\n")
+
+	info := slot.(*memorySlot).Info()
+	if info[2] != "expire_event=false" || info[4] != "notify=true" {
+		t.Fatalf("unexpected info: %v", info)
+	}
+}
+
+func TestNotifyTimeoutExpired(t *testing.T) {
+	events := make(chan string, 10)
+	slot, _ := newTimeoutSlot(1, "connection", 0, map[string]string{}, nil, "002")
+	slot.notifier = newNotifier(notifyManager(events), "002", slot.CanRead)
+	slot.timeout = 20 * time.Millisecond
+
+	slot.Write("owner", nil)
+	expectEvent(t, events, "a002write|owner\n")
+	expectEvent(t, events, "a002expire|owner\n")
+
+	select {
+	case event := <-events:
+		t.Fatalf("the expiration must be notified once: %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, conn := net.Pipe()
+	slot.timeout = time.Minute
+	slot.Write("again", conn)
+	expectEvent(t, events, "a002write|again\n")
+
+	slot.Release(Caller{Conn: conn})
+	expectEvent(t, events, "a002release|again\n")
+}
+
+func TestNotifyTokenBucketExhausted(t *testing.T) {
+	events := make(chan string, 10)
+	slot, _ := newTokenBucketSlot("hour", "interval", 2, 2, 1, map[string]string{})
+	slot.notifier = newNotifier(notifyManager(events), "003", slot.CanRead)
+
+	slot.Read()
+	slot.Read()
+	expectEvent(t, events, "a003exhausted|\n")
+
+	slot.Read()
+	select {
+	case event := <-events:
+		t.Fatalf("empty buckets must not notify again: %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyLeakyBucketFull(t *testing.T) {
+	events := make(chan string, 10)
+	slot, _ := newLeakyBucketSlot(2, 60000, map[string]string{})
+	slot.notifier = newNotifier(notifyManager(events), "004", slot.CanRead)
+
+	slot.Read()
+	slot.Read()
+	expectEvent(t, events, "a004full|\n")
+}
+
+func TestNotifyAtomicIncrement(t *testing.T) {
+	events := make(chan string, 10)
+	slot := loadAtomicSlot(t)
+	slot.notifier = newNotifier(notifyManager(events), "005", slot.CanRead)
+
+	slot.Read()
+	expectEvent(t, events, "a005write|1\n")
+
+	slot.Write("41", nil)
+	expectEvent(t, events, "a005write|41\n")
+
+	slot.Read()
+	expectEvent(t, events, "a005write|42\n")
+}
+
+func TestNotifyKeyedNotSupported(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "token_bucket")
+	v.Set("bucket_size", 10)
+	v.Set("period", "hour")
+	v.Set("keyed", true)
+	v.Set("notify", true)
+
+	if _, err := GetSlot(v, nil, "005"); err == nil {
+		t.Fatalf("Keyed slots must not send change events")
+	}
+}
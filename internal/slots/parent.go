@@ -0,0 +1,48 @@
+package slots
+
+import (
+	"fmt"
+)
+
+// parented is implemented by the slots that can take their tokens from a
+// parent limiter.
+type parented interface {
+	setParent(parent limiter, id string)
+	parentLimiter() limiter
+}
+
+// limiter is implemented by the limiter slots that can be the parent of
+// other limiters. A limiter takes its own lock before taking the tokens from
+// its parent, so the tokens are taken from every limiter at once.
+type limiter interface {
+	parented
+	// take removes the tokens from the limiter and its parents and returns
+	// the number of tokens taken. When partial is false the tokens are taken
+	// only if all of them are available.
+	take(tokens int, partial bool) int
+	// refund returns the tokens to the limiter and its parents.
+	refund(tokens int)
+}
+
+// SetParent makes the parent limit the tokens handed out by the child, a
+// token is only granted when both the child and the parent have it.
+func SetParent(child Slot, parent Slot, parentID string) error {
+	c, ok := child.(parented)
+	if !ok {
+		return fmt.Errorf("only limiter slots can have a parent")
+	}
+
+	p, ok := parent.(limiter)
+	if !ok {
+		return fmt.Errorf("parent %s must be a token_bucket or leaky_bucket slot", parentID)
+	}
+
+	for ancestor := p; ancestor != nil; ancestor = ancestor.parentLimiter() {
+		if any(ancestor) == any(c) {
+			return fmt.Errorf("parent %s creates a cycle of limiters", parentID)
+		}
+	}
+
+	c.setParent(p, parentID)
+	return nil
+}
@@ -0,0 +1,103 @@
+package slots
+
+import (
+	"testing"
+)
+
+func TestParentLimitsChild(t *testing.T) {
+	child, _ := newTokenBucketSlot("hour", "interval", 5, 5, 2, map[string]string{})
+	parent, _ := newTokenBucketSlot("hour", "interval", 3, 3, 1, map[string]string{})
+
+	err := SetParent(child, parent, "001")
+	if err != nil {
+		t.Fatalf("error setting parent: %s", err)
+	}
+
+	if child.Read() != "2" {
+		t.Fatalf("child must take the tokens from the parent")
+	}
+
+	if child.Read() != "1" {
+		t.Fatalf("child must be limited by the parent")
+	}
+
+	if child.Read() != "0" {
+		t.Fatalf("parent must be empty")
+	}
+
+	// The child keeps the tokens the parent could not grant
+	if child.value != 2 {
+		t.Fatalf("child must only lose the tokens granted: %d", child.value)
+	}
+}
+
+func TestParentTakeIsAtomic(t *testing.T) {
+	child, _ := newTokenBucketSlot("hour", "interval", 10, 10, 1, map[string]string{})
+	parent, _ := newTokenBucketSlot("hour", "interval", 4, 4, 1, map[string]string{})
+	SetParent(child, parent, "001")
+
+	if _, err := child.Take(5, Caller{}); err != ErrNotEnoughTokens {
+		t.Fatalf("take must fail when the parent does not have the tokens: %v", err)
+	}
+
+	if child.value != 10 || parent.value != 4 {
+		t.Fatalf("no tokens must be taken on failure: %d %d", child.value, parent.value)
+	}
+
+	child.Take(3, Caller{})
+	child.Refund(2, Caller{})
+	if child.value != 9 || parent.value != 3 {
+		t.Fatalf("refunds must return the tokens to the parent: %d %d", child.value, parent.value)
+	}
+}
+
+func TestParentLeakyBucket(t *testing.T) {
+	child, _ := newLeakyBucketSlot(10, 100000, map[string]string{})
+	parent, _ := newLeakyBucketSlot(1, 100000, map[string]string{})
+	SetParent(child, parent, "001")
+
+	if child.Read() != "1" {
+		t.Fatalf("first token must be accepted")
+	}
+
+	if child.Read() != "0" {
+		t.Fatalf("parent must be full")
+	}
+}
+
+func TestParentKeyed(t *testing.T) {
+	slot := loadKeyedSlot(t, 10, 0)
+	parent, _ := newTokenBucketSlot("hour", "interval", 1, 1, 1, map[string]string{})
+	SetParent(slot, parent, "001")
+
+	if readKey(t, slot, "one") != "1" {
+		t.Fatalf("first key must take the token of the parent")
+	}
+
+	if readKey(t, slot, "two") != "0" {
+		t.Fatalf("every key must be limited by the parent")
+	}
+}
+
+func TestParentInvalid(t *testing.T) {
+	first, _ := newTokenBucketSlot("hour", "interval", 1, 1, 1, map[string]string{})
+	second, _ := newTokenBucketSlot("hour", "interval", 1, 1, 1, map[string]string{})
+	memory := newMemorySlot(map[string]string{}, 0, false, nil, "")
+
+	if err := SetParent(memory, first, "001"); err == nil {
+		t.Fatalf("memory slots cannot have a parent")
+	}
+
+	if err := SetParent(first, memory, "002"); err == nil {
+		t.Fatalf("memory slots cannot be a parent")
+	}
+
+	if err := SetParent(first, first, "001"); err == nil {
+		t.Fatalf("a slot cannot be its own parent")
+	}
+
+	SetParent(first, second, "002")
+	if err := SetParent(second, first, "001"); err == nil {
+		t.Fatalf("parents cannot create a cycle")
+	}
+}
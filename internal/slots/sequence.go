@@ -0,0 +1,259 @@
+package slots
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/cluster"
+)
+
+// SupportedLimitPolicies are what sequence slots do when the next value is
+// over the upper bound: start again from the first value or fail.
+var SupportedLimitPolicies = map[string]bool{
+	"wrap": true,
+	"fail": true,
+}
+
+// ErrSequenceExhausted is returned when a sequence slot that fails at the
+// upper bound has handed out all its values.
+var ErrSequenceExhausted = errors.New("sequence slot has no more values")
+
+// sequenceSlot hands out strictly increasing numbers, every read returns the
+// next one. The leader replicates the last value to the other nodes of the
+// cluster, so the node that becomes the next leader continues after it. The
+// margin is skipped after a change of leader to cover the values that were
+// not replicated before the old leader failed.
+type sequenceSlot struct {
+	users    map[string]string
+	id       string
+	start    int64
+	step     int64
+	max      int64
+	onLimit  string
+	margin   int64
+	last     int64
+	cycle    uint64
+	issued   bool
+	checked  bool
+	term     uint64
+	versions versions
+	cluster  cluster.Cluster
+	mu       sync.Mutex
+}
+
+func newSequenceSlot(start, step, max int64, onLimit string, margin int64, users map[string]string, id string) (*sequenceSlot, error) {
+	if step < 1 {
+		return nil, fmt.Errorf("step must be bigger than zero")
+	}
+
+	if max < start {
+		return nil, fmt.Errorf("max cannot be smaller than start")
+	}
+
+	if !SupportedLimitPolicies[onLimit] {
+		return nil, fmt.Errorf("on_limit value is invalid on sequence slot: %s", onLimit)
+	}
+
+	if margin < 0 {
+		return nil, fmt.Errorf("margin cannot be negative")
+	}
+
+	return &sequenceSlot{
+		users:   users,
+		id:      id,
+		start:   start,
+		step:    step,
+		max:     max,
+		onLimit: onLimit,
+		margin:  margin,
+		cluster: cluster.NewEmptyCluster(),
+	}, nil
+}
+
+// Read hands out the next value, it returns an empty value when there are no
+// more values.
+func (m *sequenceSlot) Read() string {
+	value, err := m.Next()
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// Next hands out the next value of the sequence and replicates it to the
+// other nodes of the cluster.
+func (m *sequenceSlot) Next() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.takeOver()
+
+	last, cycle, err := m.advance(m.last, m.cycle, m.issued)
+	if err != nil {
+		return "", err
+	}
+
+	m.last = last
+	m.cycle = cycle
+	m.issued = true
+	m.versions.bump()
+	m.cluster.Replicate(m.key(), m.position())
+	return strconv.FormatInt(m.last, 10), nil
+}
+
+// Peek returns the last value handed out without handing out a new one.
+func (m *sequenceSlot) Peek() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.issued {
+		return ""
+	}
+	return strconv.FormatInt(m.last, 10)
+}
+
+func (m *sequenceSlot) Since(version uint64) (uint64, string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number, changed := m.versions.since(version)
+	if !m.issued {
+		return number, "", changed
+	}
+	return number, strconv.FormatInt(m.last, 10), changed
+}
+
+// advance returns the value after the given one and the number of times the
+// sequence wrapped around.
+func (m *sequenceSlot) advance(last int64, cycle uint64, issued bool) (int64, uint64, error) {
+	if !issued {
+		return m.start, cycle, nil
+	}
+
+	if last <= m.max-m.step {
+		return last + m.step, cycle, nil
+	}
+
+	if m.onLimit == "fail" {
+		return last, cycle, ErrSequenceExhausted
+	}
+	return m.start, cycle + 1, nil
+}
+
+// takeOver continues the sequence from the last value replicated by the
+// previous leader when it is ahead of the local one, skipping the margin.
+// The replicated value is only checked once after every change of leader.
+// It must be called holding the lock.
+func (m *sequenceSlot) takeOver() {
+	term := m.cluster.Term()
+	if m.checked && term == m.term {
+		return
+	}
+
+	m.checked = true
+	m.term = term
+	replicated, ok := m.cluster.Replicated(m.key())
+	if !ok {
+		return
+	}
+
+	cycleValue, lastValue, _ := strings.Cut(replicated, "|")
+	cycle, err := strconv.ParseUint(cycleValue, 10, 64)
+	if err != nil {
+		return
+	}
+
+	last, err := strconv.ParseInt(lastValue, 10, 64)
+	if err != nil || last < m.start || last > m.max {
+		return
+	}
+
+	if m.issued && (cycle < m.cycle || (cycle == m.cycle && last <= m.last)) {
+		return
+	}
+
+	m.last, m.cycle = m.skip(last, cycle, m.margin)
+	m.issued = true
+}
+
+// skip returns the value the given number of steps after the given one and
+// the number of times the sequence wrapped around. Sequences that fail at
+// the upper bound stop at the last value.
+func (m *sequenceSlot) skip(last int64, cycle uint64, steps int64) (int64, uint64) {
+	// The values are counted from the start, the differences always fit in
+	// an unsigned integer
+	step := uint64(m.step)
+	index := uint64(last-m.start) / step
+	lastIndex := uint64(m.max-m.start) / step
+	remaining := uint64(steps)
+
+	switch {
+	case remaining <= lastIndex-index:
+		index += remaining
+	case m.onLimit == "fail":
+		index = lastIndex
+	default:
+		// Continue from the first value of the next cycle, the number of
+		// values only overflows when it is bigger than any margin
+		remaining -= lastIndex - index + 1
+		cycle++
+		if values := lastIndex + 1; values != 0 {
+			cycle += remaining / values
+			remaining %= values
+		}
+		index = remaining
+	}
+
+	return int64(uint64(m.start) + index*step), cycle
+}
+
+func (m *sequenceSlot) key() string {
+	return "sequence_" + m.id
+}
+
+// position returns the last value and the number of times the sequence
+// wrapped around, it must be called holding the lock.
+func (m *sequenceSlot) position() string {
+	return strconv.FormatUint(m.cycle, 10) + "|" + strconv.FormatInt(m.last, 10)
+}
+
+func (m *sequenceSlot) Write(data string, from net.Conn) (string, error) {
+	return "", fmt.Errorf("sequence slots cannot be written")
+}
+
+func (m *sequenceSlot) Info() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := ""
+	if m.issued {
+		last = strconv.FormatInt(m.last, 10)
+	}
+
+	return []string{
+		"kind=sequence",
+		"last=" + last,
+		"start=" + strconv.FormatInt(m.start, 10),
+		"step=" + strconv.FormatInt(m.step, 10),
+		"max=" + strconv.FormatInt(m.max, 10),
+		"on_limit=" + m.onLimit,
+		"margin=" + strconv.FormatInt(m.margin, 10),
+	}
+}
+
+func (m *sequenceSlot) CanRead(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "r" || m.users[u.Name] == "a"
+}
+
+func (m *sequenceSlot) CanWrite(u *auth.User) bool {
+	return false
+}
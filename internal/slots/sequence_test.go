@@ -0,0 +1,200 @@
+package slots
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/dankomiocevic/ghoti/internal/cluster"
+)
+
+// replicatedCluster keeps the replicated values in memory, like a cluster
+// where every value reaches the other nodes. The term is increased to change
+// the leader.
+type replicatedCluster struct {
+	cluster.EmptyCluster
+	state map[string]string
+	term  uint64
+}
+
+func (c *replicatedCluster) Term() uint64 {
+	return c.term
+}
+
+func (c *replicatedCluster) Replicate(key string, value string) {
+	c.state[key] = value
+}
+
+func (c *replicatedCluster) Replicated(key string) (string, bool) {
+	value, ok := c.state[key]
+	return value, ok
+}
+
+func TestSequenceNext(t *testing.T) {
+	slot, _ := newSequenceSlot(10, 5, 20, "fail", 0, map[string]string{}, "000")
+
+	if slot.Peek() != "" {
+		t.Fatalf("new sequences must not have a value: %s", slot.Peek())
+	}
+
+	for _, expected := range []string{"10", "15", "20"} {
+		value, err := slot.Next()
+		if err != nil || value != expected {
+			t.Fatalf("next value must be %s, got %s %v", expected, value, err)
+		}
+	}
+
+	if _, err := slot.Next(); err != ErrSequenceExhausted {
+		t.Fatalf("sequences must fail at the bound: %v", err)
+	}
+
+	if slot.Read() != "" || slot.Peek() != "20" {
+		t.Fatalf("exhausted sequences must keep the last value: %s", slot.Peek())
+	}
+}
+
+func TestSequenceWrap(t *testing.T) {
+	slot, _ := newSequenceSlot(1, 1, 2, "wrap", 0, map[string]string{}, "000")
+
+	for _, expected := range []string{"1", "2", "1", "2"} {
+		if value := slot.Read(); value != expected {
+			t.Fatalf("next value must be %s, got %s", expected, value)
+		}
+	}
+}
+
+func TestSequenceTakeOver(t *testing.T) {
+	c := &replicatedCluster{state: make(map[string]string)}
+
+	leader, _ := newSequenceSlot(1, 1, 1000, "fail", 10, map[string]string{}, "000")
+	SetServer(leader, c, "telnet")
+	leader.Read()
+	leader.Read()
+
+	if c.state["sequence_000"] != "0|2" {
+		t.Fatalf("the last value must be replicated: %s", c.state["sequence_000"])
+	}
+
+	c.term++
+	follower, _ := newSequenceSlot(1, 1, 1000, "fail", 10, map[string]string{}, "000")
+	SetServer(follower, c, "telnet")
+	if value := follower.Read(); value != "13" {
+		t.Fatalf("the new leader must continue after the margin: %s", value)
+	}
+
+	if value := follower.Read(); value != "14" {
+		t.Fatalf("the margin must be skipped once: %s", value)
+	}
+
+	c.term++
+	if value := leader.Read(); value != "25" {
+		t.Fatalf("old leaders must continue after the new one: %s", value)
+	}
+}
+
+func TestSequenceTakeOverAfterWrap(t *testing.T) {
+	c := &replicatedCluster{state: map[string]string{"sequence_000": "1|3"}}
+
+	slot, _ := newSequenceSlot(1, 1, 5, "wrap", 3, map[string]string{}, "000")
+	SetServer(slot, c, "telnet")
+	slot.last = 4
+	slot.issued = true
+
+	if value := slot.Read(); value != "2" {
+		t.Fatalf("later cycles must be taken over: %s", value)
+	}
+}
+
+func TestSequenceTakeOverOnce(t *testing.T) {
+	c := &replicatedCluster{state: map[string]string{"sequence_000": "0|5"}}
+
+	slot, _ := newSequenceSlot(1, 1, 1000, "fail", 0, map[string]string{}, "000")
+	SetServer(slot, c, "telnet")
+	if value := slot.Read(); value != "6" {
+		t.Fatalf("the sequence must continue after the replicated value: %s", value)
+	}
+
+	c.state["sequence_000"] = "0|100"
+	if value := slot.Read(); value != "7" {
+		t.Fatalf("the replicated value must only be checked when the leader changes: %s", value)
+	}
+
+	// The slot replicates its own values, the new leader sends a newer one
+	c.state["sequence_000"] = "0|100"
+	c.term++
+	if value := slot.Read(); value != "101" {
+		t.Fatalf("the replicated value must be checked after a change of leader: %s", value)
+	}
+}
+
+func TestSequenceTakeOverMargin(t *testing.T) {
+	tests := []struct {
+		start, step, max int64
+		onLimit          string
+		margin           int64
+		replicated       string
+		expected         string
+	}{
+		{1, 1, 1000, "fail", 1 << 40, "0|2", ""},
+		{1, 1, 1000, "fail", 997, "0|2", "1000"},
+		{1, 1, 1000, "fail", 998, "0|2", ""},
+		{0, 10, 95, "wrap", 25, "0|30", "90"},
+		{0, 10, 95, "wrap", 1<<40 + 3, "2|0", "0"},
+		{-1 << 63, 1, 1<<63 - 1, "wrap", 1<<63 - 1, "0|0", "-9223372036854775808"},
+		{-1 << 63, 1, 1<<63 - 1, "wrap", 5, "0|9223372036854775807", "-9223372036854775803"},
+	}
+
+	for _, test := range tests {
+		c := &replicatedCluster{state: map[string]string{"sequence_000": test.replicated}}
+		slot, _ := newSequenceSlot(test.start, test.step, test.max, test.onLimit, test.margin, map[string]string{}, "000")
+		SetServer(slot, c, "telnet")
+
+		if value := slot.Read(); value != test.expected {
+			t.Fatalf("unexpected value after skipping %d from %s: %s", test.margin, test.replicated, value)
+		}
+	}
+}
+
+func TestSequenceConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "sequence")
+	v.Set("start", 100)
+	v.Set("step", 10)
+	v.Set("max", 1000)
+	v.Set("on_limit", "wrap")
+
+	slot, err := GetSlot(v, nil, "000")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	if value := slot.Read(); value != "100" {
+		t.Fatalf("the sequence must begin at the start: %s", value)
+	}
+
+	if _, err := slot.Write("5", nil); err == nil {
+		t.Fatalf("sequence slots must not be written")
+	}
+
+	info := slot.(Inspector).Info()
+	if info[0] != "kind=sequence" || info[1] != "last=100" || info[6] != "margin=100" {
+		t.Fatalf("unexpected info: %v", info)
+	}
+
+	v.Set("on_limit", "stop")
+	if _, err := GetSlot(v, nil, "000"); err == nil {
+		t.Fatalf("invalid policies must return an error")
+	}
+
+	v.Set("on_limit", "fail")
+	v.Set("step", 0)
+	if _, err := GetSlot(v, nil, "000"); err == nil {
+		t.Fatalf("the step must be bigger than zero")
+	}
+
+	v.Set("step", 1)
+	v.Set("max", 10)
+	if _, err := GetSlot(v, nil, "000"); err == nil {
+		t.Fatalf("the bound must not be smaller than the start")
+	}
+}
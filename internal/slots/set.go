@@ -0,0 +1,156 @@
+package slots
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/dankomiocevic/ghoti/internal/auth"
+)
+
+// ErrSetFull is returned when a new member is added to a set slot that
+// already has the maximum number of members.
+var ErrSetFull = errors.New("set slot has too many members")
+
+// ErrMissingMember is returned when a set slot is used without a member.
+var ErrMissingMember = errors.New("member must be set for set slots")
+
+// setSlot keeps a group of unique members, the changes can be sent to the
+// subscribed clients as change events.
+type setSlot struct {
+	users      map[string]string
+	members    map[string]struct{}
+	maxMembers int
+	notifier   *notifier
+	mu         sync.RWMutex
+}
+
+func newSetSlot(maxMembers int, users map[string]string) (*setSlot, error) {
+	if maxMembers < 1 {
+		return nil, fmt.Errorf("max_members must be bigger than zero")
+	}
+
+	return &setSlot{
+		users:      users,
+		members:    make(map[string]struct{}),
+		maxMembers: maxMembers,
+	}, nil
+}
+
+// Read returns an empty value, the members are listed with the collection
+// operations.
+func (m *setSlot) Read() string {
+	return ""
+}
+
+func (m *setSlot) Write(data string, from net.Conn) (string, error) {
+	return "", fmt.Errorf("set slots cannot be used to write, members must be added")
+}
+
+// Add adds the member and reports whether it was not in the set.
+func (m *setSlot) Add(member string) (bool, error) {
+	if member == "" {
+		return false, ErrMissingMember
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[member]; ok {
+		return false, nil
+	}
+
+	if len(m.members) >= m.maxMembers {
+		return false, ErrSetFull
+	}
+
+	m.members[member] = struct{}{}
+	m.notifier.notify("add", member)
+	return true, nil
+}
+
+func (m *setSlot) Has(member string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.members[member]
+	return ok
+}
+
+// Remove deletes the member and reports whether it was in the set.
+func (m *setSlot) Remove(member string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[member]; !ok {
+		return false
+	}
+
+	delete(m.members, member)
+	m.notifier.notify("del", member)
+	return true
+}
+
+// List returns the members in order after the given one, up to the limit.
+func (m *setSlot) List(after string, limit int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := make([]string, 0, len(m.members))
+	for member := range m.members {
+		if member > after {
+			members = append(members, member)
+		}
+	}
+
+	slices.Sort(members)
+	return members[:min(limit, len(members))]
+}
+
+func (m *setSlot) Size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.members)
+}
+
+// Reset removes all the members.
+func (m *setSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.members = make(map[string]struct{})
+	m.notifier.notify("reset", "")
+	return ""
+}
+
+func (m *setSlot) Info() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return []string{
+		"kind=set",
+		"members=" + strconv.Itoa(len(m.members)),
+		"max_members=" + strconv.Itoa(m.maxMembers),
+		"notify=" + strconv.FormatBool(m.notifier.enabled()),
+	}
+}
+
+func (m *setSlot) CanRead(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "r" || m.users[u.Name] == "a"
+}
+
+func (m *setSlot) CanWrite(u *auth.User) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+
+	return m.users[u.Name] == "w" || m.users[u.Name] == "a"
+}
@@ -0,0 +1,91 @@
+package slots
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSetAddAndRemove(t *testing.T) {
+	slot, _ := newSetSlot(2, map[string]string{})
+
+	added, err := slot.Add("eu-west")
+	if !added || err != nil {
+		t.Fatalf("new members must be added: %v", err)
+	}
+
+	added, _ = slot.Add("eu-west")
+	if added {
+		t.Fatalf("members must be added once")
+	}
+
+	slot.Add("us-east")
+	if _, err := slot.Add("ap-south"); err != ErrSetFull {
+		t.Fatalf("members must not be added when the set is full: %v", err)
+	}
+
+	if _, err := slot.Add(""); err != ErrMissingMember {
+		t.Fatalf("empty members must not be added: %v", err)
+	}
+
+	if !slot.Has("eu-west") || slot.Has("ap-south") {
+		t.Fatalf("unexpected membership")
+	}
+
+	if !slot.Remove("eu-west") || slot.Remove("eu-west") {
+		t.Fatalf("Remove must report whether the member existed")
+	}
+
+	if slot.Size() != 1 {
+		t.Fatalf("Size should be 1, got %d", slot.Size())
+	}
+}
+
+func TestSetList(t *testing.T) {
+	slot, _ := newSetSlot(10, map[string]string{})
+	for _, member := range []string{"c", "a", "b"} {
+		slot.Add(member)
+	}
+
+	members := slot.List("", 2)
+	if len(members) != 2 || members[0] != "a" || members[1] != "b" {
+		t.Fatalf("members must be listed in order: %v", members)
+	}
+
+	members = slot.List("b", 2)
+	if len(members) != 1 || members[0] != "c" {
+		t.Fatalf("the next page must start after the last member: %v", members)
+	}
+}
+
+func TestSetNotify(t *testing.T) {
+	events := make(chan string, 10)
+	v := viper.New()
+	v.Set("kind", "set")
+	v.Set("notify", true)
+
+	slot, err := GetSlot(v, notifyManager(events), "001")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	set := slot.(*setSlot)
+	set.Add("eu-west")
+	set.Add("eu-west")
+	set.Remove("eu-west")
+	set.Reset()
+
+	expectEvent(t, events, "a001add|eu-west\n")
+	expectEvent(t, events, "a001del|eu-west\n")
+	expectEvent(t, events, "a001reset|\n")
+}
+
+func TestSetConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "set")
+	v.Set("max_members", 0)
+
+	if _, err := GetSlot(v, nil, "000"); err == nil {
+		t.Fatalf("Slot must return error when max_members is zero")
+	}
+}
@@ -0,0 +1,39 @@
+package slots
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/dankomiocevic/ghoti/internal/telemetry"
+)
+
+// shadowMode is used by limiters that do not enforce their limit, they
+// allow every request and count the requests that would have been denied.
+type shadowMode struct {
+	slot   int
+	denied atomic.Int64
+}
+
+func newShadowMode(id string) *shadowMode {
+	slot, err := strconv.Atoi(id)
+	if err != nil {
+		slot = -1
+	}
+
+	return &shadowMode{slot: slot}
+}
+
+// deny records a request that would have been denied.
+func (m *shadowMode) deny() {
+	m.denied.Add(1)
+	telemetry.RecordShadowDenied(m.slot)
+}
+
+// info returns the information of the shadow mode for the Info command.
+func (m *shadowMode) info() []string {
+	if m == nil {
+		return []string{"shadow=false"}
+	}
+
+	return []string{"shadow=true", "shadow_denied=" + strconv.FormatInt(m.denied.Load(), 10)}
+}
@@ -3,7 +3,9 @@ package slots
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -18,6 +20,158 @@ type Slot interface {
 	CanWrite(*auth.User) bool
 }
 
+// Inspector is implemented by slots that can describe their kind, configuration
+// and live state. Every entry has the form key=value and the first one is
+// always the kind of the slot.
+type Inspector interface {
+	Info() []string
+}
+
+// Expirer is implemented by slots whose values can expire, after the ttl the
+// value is cleared. A ttl of zero means that the value never expires.
+type Expirer interface {
+	WriteWithTTL(data string, ttl time.Duration, from net.Conn) (string, error)
+}
+
+// Resetter is implemented by slots that can be taken back to their initial
+// state. Reset returns the value of the slot after the reset.
+type Resetter interface {
+	Reset() string
+}
+
+// ErrValueMismatch is returned by CompareAndSwap when the current value of
+// the slot is not the expected one.
+var ErrValueMismatch = errors.New("slot value does not match the expected value")
+
+// Caller identifies the client that executes a command on a slot, the ID is
+// the identifier of the connection used to send it async events.
+type Caller struct {
+	ID      string
+	Conn    net.Conn
+	User    string
+	Session string
+}
+
+// Swapper is implemented by slots that can replace their value only when it
+// matches an expected one, as a single operation.
+type Swapper interface {
+	CompareAndSwap(expected string, data string, caller Caller) (string, error)
+}
+
+// Owned is implemented by slots that belong to the client that writes them,
+// the owner can release the slot or renew its ownership without writing it.
+type Owned interface {
+	WriteAs(data string, caller Caller) (string, error)
+	Release(caller Caller) (string, error)
+	Renew(caller Caller) (string, error)
+}
+
+// Waiter is implemented by slots where clients can wait in line to write.
+// Acquire writes the slot when it is available and returns a position of
+// zero, otherwise the caller is queued and the returned position is its
+// place in the line. Queued callers receive an async event with the value
+// when the slot is handed over to them.
+type Waiter interface {
+	Acquire(data string, caller Caller) (string, int, error)
+}
+
+// Taker is implemented by slots that hand out a number of tokens requested
+// by the caller and accept back the tokens that were not used. Callers can
+// only return the tokens they took.
+type Taker interface {
+	Take(tokens int, caller Caller) (int, error)
+	Refund(tokens int, caller Caller) (int, error)
+}
+
+// Limiter is implemented by slots that limit the rate of requests. Allow
+// takes the tokens of a request and returns the response of the slot and
+// whether the request was allowed.
+type Limiter interface {
+	Allow() (string, bool)
+}
+
+// Restorer is implemented by slots whose changes can be undone. Save holds
+// the changes of the slot from the clients waiting for them and returns a
+// function that ends the batch: the changes are committed and notified, or
+// the slot is taken back to the state it had when Save was called without
+// waking anyone. Batches use it to roll back their commands when one of them
+// fails.
+type Restorer interface {
+	Save() func(commit bool)
+}
+
+// Issuer is implemented by slots that hand out a new value on every read
+// and can run out of values.
+type Issuer interface {
+	Next() (string, error)
+}
+
+// Peeker is implemented by slots whose value can be read without modifying
+// it, so other slots can compute their value from it.
+type Peeker interface {
+	Peek() string
+}
+
+// Versioned is implemented by slots that count the changes of their value.
+// Since returns the current version and value of the slot and, when the
+// version is not newer than the given one, a channel that is closed on the
+// next change so clients can wait for it.
+type Versioned interface {
+	Since(version uint64) (uint64, string, <-chan struct{})
+}
+
+// Keyed is implemented by slots that keep an independent slot for every key,
+// commands on these slots carry the key that selects the slot to use.
+type Keyed interface {
+	Key(key string) (Slot, error)
+}
+
+// Collection is implemented by slots that hold many entries. Remove deletes
+// an entry and reports whether it existed, List returns the entries sorted
+// after the given one up to the limit, so they can be listed in pages.
+type Collection interface {
+	Remove(entry string) bool
+	List(after string, limit int) []string
+	Size() int
+}
+
+// Membership is implemented by slots that keep a group of unique members.
+// Add reports whether the member was not in the group before.
+type Membership interface {
+	Add(member string) (bool, error)
+	Has(member string) bool
+}
+
+// Replayer is implemented by slots that can number their async events and
+// keep the last ones, so subscribers can receive the events they missed.
+type Replayer interface {
+	HasHistory() bool
+	Replay(after uint64) []string
+	Sequence() uint64
+}
+
+// Acknowledger is implemented by slots whose async events can require the
+// acknowledgement of the subscribers. WriteAcknowledged writes the slot and
+// returns the connections that acknowledged the event, Ack registers the
+// acknowledgement of the event with the sequence number by the connection.
+type Acknowledger interface {
+	IsReliable() bool
+	WriteAcknowledged(data string) ([]string, error)
+	WriteAcknowledgedWithTTL(data string, ttl time.Duration) ([]string, error)
+	Ack(seq uint64, id string)
+}
+
+// WriteAs writes the slot on behalf of the caller, slots that have owners
+// identify the caller by the connection, user or session depending on their
+// configuration.
+func WriteAs(slot Slot, data string, caller Caller) (string, error) {
+	if owned, ok := slot.(Owned); ok {
+		return owned.WriteAs(data, caller)
+	}
+
+	return slot.Write(data, caller.Conn)
+}
+
 func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string) (Slot, error) {
 	kind := v.GetString("kind")
 	usersConfig := v.GetStringMap("users")
@@ -27,8 +181,29 @@ func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string
 		users[key] = fmt.Sprintf("%v", value)
 	}
 
+	defaultTTL := 0
+	if v.IsSet("default_ttl") {
+		defaultTTL = v.GetInt("default_ttl")
+		if defaultTTL < 0 {
+			return nil, fmt.Errorf("default_ttl cannot be negative")
+		}
+	}
+	expireEvent := v.GetBool("expire_event")
+
+	var shadow *shadowMode
+	if v.GetBool("shadow") {
+		shadow = newShadowMode(id)
+	}
+
+	// Change events are sent to the clients subscribed to the slot
+	notify := v.GetBool("notify")
+
 	if kind == "simple_memory" {
-		return &memorySlot{value: "", users: users}, nil
+		memorySlot := newMemorySlot(users, defaultTTL, expireEvent, conn, id)
+		if notify {
+			memorySlot.notifier = newNotifier(conn, id, memorySlot.CanRead)
+		}
+		return memorySlot, nil
 	}
 
 	if kind == "timeout_memory" {
@@ -36,10 +211,25 @@ func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string
 			return nil, fmt.Errorf("timeout value must be set for timeout_memory slot")
 		}
 		timeoutConfig := v.GetInt("timeout")
-		timeoutSlot, err := newTimeoutSlot(timeoutConfig, users)
+
+		ownerMode := "connection"
+		if v.IsSet("owner_mode") {
+			ownerMode = v.GetString("owner_mode")
+		}
+
+		maxWaiters := 100
+		if v.IsSet("max_waiters") {
+			maxWaiters = v.GetInt("max_waiters")
+		}
+
+		timeoutSlot, err := newTimeoutSlot(timeoutConfig, ownerMode, maxWaiters, users, conn, id)
 		if err != nil {
 			return nil, err
 		}
+
+		if notify {
+			timeoutSlot.notifier = newNotifier(conn, id, timeoutSlot.CanRead)
+		}
 		return timeoutSlot, nil
 	}
 
@@ -64,11 +254,32 @@ func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string
 			tokensPerReq = v.GetInt("tokens_per_req")
 		}
 
-		tokenBucket, err := newTokenBucketSlot(periodString, bucketSize, refreshRate, tokensPerReq, users)
+		refillMode := "interval"
+		if v.IsSet("refill") {
+			refillMode = v.GetString("refill")
+		}
+
+		create := func() (Slot, error) {
+			tokenBucket, err := newTokenBucketSlot(periodString, refillMode, bucketSize, refreshRate, tokensPerReq, users)
+			if err != nil {
+				return nil, err
+			}
+			tokenBucket.shadow = shadow
+			return tokenBucket, nil
+		}
+
+		if v.GetBool("keyed") {
+			return getKeyedSlot(v, kind, users, shadow, create)
+		}
+
+		tokenBucket, err := create()
 		if err != nil {
 			return nil, err
 		}
 
+		if notify {
+			tokenBucket.(*tokenBucketSlot).notifier = newNotifier(conn, id, tokenBucket.CanRead)
+		}
 		return tokenBucket, nil
 	}
 
@@ -83,11 +294,30 @@ func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string
 			refreshRate = v.GetInt("refresh_rate")
 		}
 
-		leakyBucket, err := newLeakyBucketSlot(bucketSize, refreshRate, users)
+		queue := v.GetBool("queue")
+
+		create := func() (Slot, error) {
+			leakyBucket, err := newLeakyBucketSlot(bucketSize, refreshRate, users)
+			if err != nil {
+				return nil, err
+			}
+			leakyBucket.shadow = shadow
+			leakyBucket.queue = queue
+			return leakyBucket, nil
+		}
+
+		if v.GetBool("keyed") {
+			return getKeyedSlot(v, kind, users, shadow, create)
+		}
+
+		leakyBucket, err := create()
 		if err != nil {
 			return nil, err
 		}
 
+		if notify {
+			leakyBucket.(*leakyBucketSlot).notifier = newNotifier(conn, id, leakyBucket.CanRead)
+		}
 		return leakyBucket, nil
 	}
 
@@ -114,16 +344,192 @@ func GetSlot(v *viper.Viper, conn connectionmanager.ConnectionManager, id string
 			return nil, err
 		}
 
+		if v.IsSet("direction") {
+			tickerSlot.direction = v.GetString("direction")
+			if !SupportedDirections[tickerSlot.direction] {
+				return nil, fmt.Errorf("direction value is invalid on ticker slot: %s", tickerSlot.direction)
+			}
+		}
+
+		tickerSlot.wrap = v.GetBool("wrap")
+		if tickerSlot.wrap && tickerSlot.direction == "down" {
+			// Tickers counting down wrap to the initial value by default
+			tickerSlot.maxValue = int64(initialValue)
+		}
+
+		if v.IsSet("max_value") {
+			tickerSlot.maxValue = v.GetInt64("max_value")
+			if tickerSlot.maxValue < int64(initialValue) {
+				return nil, fmt.Errorf("max_value cannot be smaller than the initial value")
+			}
+		}
+
+		if tickerSlot.wrap && tickerSlot.maxValue < 1 {
+			return nil, fmt.Errorf("max_value must be bigger than zero to wrap a ticker")
+		}
+
+		for _, threshold := range v.GetIntSlice("thresholds") {
+			if threshold < 0 {
+				return nil, fmt.Errorf("thresholds cannot be negative")
+			}
+			tickerSlot.thresholds = append(tickerSlot.thresholds, int64(threshold))
+		}
+
+		tickerSlot.manager = conn
+		tickerSlot.slotID = id
+
+		tickerSlot.mu.Lock()
+		tickerSlot.schedule()
+		tickerSlot.mu.Unlock()
+
 		return tickerSlot, nil
 	}
 
 	if kind == "broadcast" {
-		return newBroadcastSlot(users, conn, id), nil
+		broadcastSlot := newBroadcastSlot(users, conn, id)
+		broadcastSlot.expiration = expiration{defaultTTL: time.Duration(defaultTTL) * time.Second}
+		broadcastSlot.expireEvent = expireEvent
+
+		broadcastSlot.historySize = v.GetInt("history")
+		if broadcastSlot.historySize < 0 {
+			return nil, fmt.Errorf("history cannot be negative")
+		}
+
+		broadcastSlot.reliable = v.GetBool("reliable")
+		if v.IsSet("ack_timeout") {
+			broadcastSlot.ackTimeout = time.Duration(v.GetInt("ack_timeout")) * time.Millisecond
+			if broadcastSlot.ackTimeout <= 0 {
+				return nil, fmt.Errorf("ack_timeout must be bigger than zero")
+			}
+		}
+
+		if v.IsSet("ack_retry") {
+			broadcastSlot.ackRetry = time.Duration(v.GetInt("ack_retry")) * time.Millisecond
+			if broadcastSlot.ackRetry <= 0 {
+				return nil, fmt.Errorf("ack_retry must be bigger than zero")
+			}
+		}
+
+		broadcastSlot.coalesce = time.Duration(v.GetInt("coalesce_ms")) * time.Millisecond
+		if broadcastSlot.coalesce < 0 {
+			return nil, fmt.Errorf("coalesce_ms cannot be negative")
+		}
+
+		if broadcastSlot.coalesce > 0 && broadcastSlot.reliable {
+			return nil, fmt.Errorf("reliable broadcast slots cannot coalesce their events")
+		}
+
+		if v.IsSet("coalesce_mode") {
+			broadcastSlot.coalesceBy = v.GetString("coalesce_mode")
+			if !SupportedCoalesceModes[broadcastSlot.coalesceBy] {
+				return nil, fmt.Errorf("coalesce_mode value is invalid on broadcast slot: %s", broadcastSlot.coalesceBy)
+			}
+		}
+		return broadcastSlot, nil
+	}
+
+	if kind == "map" {
+		maxKeys := 1000
+		if v.IsSet("max_keys") {
+			maxKeys = v.GetInt("max_keys")
+		}
+
+		mapSlot, err := newMapSlot(maxKeys, defaultTTL, users)
+		if err != nil {
+			return nil, err
+		}
+		return mapSlot, nil
+	}
+
+	if kind == "set" {
+		maxMembers := 1000
+		if v.IsSet("max_members") {
+			maxMembers = v.GetInt("max_members")
+		}
+
+		setSlot, err := newSetSlot(maxMembers, users)
+		if err != nil {
+			return nil, err
+		}
+
+		if notify {
+			setSlot.notifier = newNotifier(conn, id, setSlot.CanRead)
+		}
+		return setSlot, nil
+	}
+
+	if kind == "computed" {
+		if !v.IsSet("expression") {
+			return nil, fmt.Errorf("expression must be set for computed slot")
+		}
+
+		computedSlot, err := newComputedSlot(v.GetString("expression"), users)
+		if err != nil {
+			return nil, err
+		}
+		return computedSlot, nil
+	}
+
+	if kind == "sequence" {
+		step := int64(1)
+		if v.IsSet("step") {
+			step = v.GetInt64("step")
+		}
+
+		max := int64(math.MaxInt64)
+		if v.IsSet("max") {
+			max = v.GetInt64("max")
+		}
+
+		onLimit := "fail"
+		if v.IsSet("on_limit") {
+			onLimit = v.GetString("on_limit")
+		}
+
+		margin := int64(100)
+		if v.IsSet("margin") {
+			margin = v.GetInt64("margin")
+		}
+
+		sequenceSlot, err := newSequenceSlot(v.GetInt64("start"), step, max, onLimit, margin, users, id)
+		if err != nil {
+			return nil, err
+		}
+		return sequenceSlot, nil
 	}
 
 	if kind == "atomic" {
-		return &atomicSlot{value: 0, users: users}, nil
+		atomicSlot := &atomicSlot{value: 0, users: users}
+		if notify {
+			atomicSlot.notifier = newNotifier(conn, id, atomicSlot.CanRead)
+		}
+		return atomicSlot, nil
 	}
 
 	return nil, errors.New("invalid kind of slot")
 }
+
+// getKeyedSlot creates a slot with an independent limiter for every key.
+func getKeyedSlot(v *viper.Viper, kind string, users map[string]string, shadow *shadowMode, create func() (Slot, error)) (Slot, error) {
+	if v.GetBool("notify") {
+		return nil, fmt.Errorf("keyed slots cannot send change events")
+	}
+
+	maxKeys := 10000
+	if v.IsSet("max_keys") {
+		maxKeys = v.GetInt("max_keys")
+	}
+
+	keyIdle := 3600
+	if v.IsSet("key_idle") {
+		keyIdle = v.GetInt("key_idle")
+	}
+
+	keyedSlot, err := newKeyedSlot(kind, maxKeys, keyIdle, users, create)
+	if err != nil {
+		return nil, err
+	}
+	keyedSlot.shadow = shadow
+
+	return keyedSlot, nil
+}
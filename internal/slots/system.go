@@ -0,0 +1,116 @@
+package slots
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dankomiocevic/ghoti/internal/appinfo"
+	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/cluster"
+	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
+)
+
+// FirstSystemSlot is the first of the slots reserved for the facts of the
+// server, from 990 to 999. They cannot be configured, the server exposes
+// SystemValues on them in order and keeps the rest for new facts.
+const FirstSystemSlot = 990
+
+// SystemValues are the facts of the server exposed on the system slots: the
+// seconds since the server started, the number of connected clients, the
+// leader and the ID of the node, the version of the build and the protocol
+// of the server.
+var SystemValues = []string{"uptime", "clients", "leader", "node", "version", "protocol"}
+
+// IsSystemSlot reports whether the slot is reserved for the facts of the
+// server.
+func IsSystemSlot(id int) bool {
+	return id >= FirstSystemSlot && id <= 999
+}
+
+// systemSlot is a read only slot that exposes a fact of the server to every
+// client. The server sets its state with SetServer when it starts.
+type systemSlot struct {
+	value    string
+	started  time.Time
+	manager  connectionmanager.ConnectionManager
+	cluster  cluster.Cluster
+	protocol string
+}
+
+// NewSystemSlots returns the system slots by their slot number, the clients
+// are counted by the connection manager.
+func NewSystemSlots(manager connectionmanager.ConnectionManager) map[int]Slot {
+	systemSlots := make(map[int]Slot, len(SystemValues))
+	for i, value := range SystemValues {
+		systemSlots[FirstSystemSlot+i] = &systemSlot{
+			value:   value,
+			started: time.Now(),
+			manager: manager,
+		}
+	}
+	return systemSlots
+}
+
+// SetServer sets the cluster and the protocol of the server on the slots
+// that use them, the uptime of system slots is counted from this moment. It
+// must be called before the server handles any command.
+func SetServer(slot Slot, c cluster.Cluster, protocol string) {
+	switch s := slot.(type) {
+	case *systemSlot:
+		s.cluster = c
+		s.protocol = protocol
+		s.started = time.Now()
+	case *sequenceSlot:
+		s.cluster = c
+	}
+}
+
+func (m *systemSlot) Read() string {
+	switch m.value {
+	case "uptime":
+		return strconv.FormatInt(int64(time.Since(m.started)/time.Second), 10)
+	case "clients":
+		if m.manager == nil {
+			return "0"
+		}
+		return strconv.Itoa(m.manager.Connected())
+	case "version":
+		return appinfo.Version
+	case "protocol":
+		return m.protocol
+	}
+
+	if m.cluster == nil {
+		return ""
+	}
+
+	if m.value == "leader" {
+		return m.cluster.GetLeader()
+	}
+	return m.cluster.GetNodeID()
+}
+
+func (m *systemSlot) Peek() string {
+	return m.Read()
+}
+
+func (m *systemSlot) Write(data string, from net.Conn) (string, error) {
+	return "", fmt.Errorf("system slots cannot be written")
+}
+
+func (m *systemSlot) Info() []string {
+	return []string{
+		"kind=system",
+		"value=" + m.value,
+	}
+}
+
+func (m *systemSlot) CanRead(u *auth.User) bool {
+	return true
+}
+
+func (m *systemSlot) CanWrite(u *auth.User) bool {
+	return false
+}
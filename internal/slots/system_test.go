@@ -0,0 +1,46 @@
+package slots
+
+import (
+	"testing"
+
+	"github.com/dankomiocevic/ghoti/internal/appinfo"
+	"github.com/dankomiocevic/ghoti/internal/cluster"
+)
+
+func TestSystemValues(t *testing.T) {
+	expected := map[int]string{
+		990: "0",
+		991: "5",
+		992: "",
+		993: "",
+		994: appinfo.Version,
+		995: "telnet",
+	}
+
+	systemSlots := NewSystemSlots(&MockConnectionManager{})
+	if len(systemSlots) != len(expected) {
+		t.Fatalf("unexpected number of system slots: %d", len(systemSlots))
+	}
+
+	for id, result := range expected {
+		slot, ok := systemSlots[id]
+		if !ok {
+			t.Fatalf("slot %d must be a system slot", id)
+		}
+
+		SetServer(slot, cluster.NewEmptyCluster(), "telnet")
+		if slot.Read() != result {
+			t.Fatalf("slot %d must be %q, got %q", id, result, slot.Read())
+		}
+
+		if _, err := slot.Write("value", nil); err == nil {
+			t.Fatalf("system slots must not be written")
+		}
+	}
+}
+
+func TestIsSystemSlot(t *testing.T) {
+	if IsSystemSlot(989) || !IsSystemSlot(990) || !IsSystemSlot(999) {
+		t.Fatalf("the slots from 990 to 999 must be reserved")
+	}
+}
@@ -4,17 +4,34 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
 )
 
+// SupportedDirections are the directions a ticker counts to.
+var SupportedDirections = map[string]bool{
+	"down": true,
+	"up":   true,
+}
+
 type tickerSlot struct {
-	users  map[string]string
-	value  int64
-	rate   int
-	window int64
-	mu     sync.Mutex
+	users      map[string]string
+	value      int64
+	initial    int64
+	rate       int
+	window     int64
+	direction  string
+	wrap       bool
+	maxValue   int64
+	thresholds []int64
+	timer      *time.Timer
+	manager    connectionmanager.ConnectionManager
+	slotID     string
+	mu         sync.Mutex
 }
 
 func newTickerSlot(refreshRate, initialValue int, users map[string]string) (*tickerSlot, error) {
@@ -26,21 +43,165 @@ func newTickerSlot(refreshRate, initialValue int, users map[string]string) (*tic
 		return nil, fmt.Errorf("initial value cannot be negative")
 	}
 
-	return &tickerSlot{value: int64(initialValue), rate: refreshRate, window: currentWindowMillis(refreshRate), users: users}, nil
+	return &tickerSlot{
+		value:     int64(initialValue),
+		initial:   int64(initialValue),
+		rate:      refreshRate,
+		window:    currentWindowMillis(refreshRate),
+		direction: "down",
+		maxValue:  -1,
+		users:     users,
+	}, nil
 }
 
-func (m *tickerSlot) Read() string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// tick moves the value by the ticks elapsed since the last call and returns
+// the thresholds crossed, it must be called holding the lock.
+func (m *tickerSlot) tick() []int64 {
 	current := currentWindowMillis(m.rate)
 	windowDiff := current - m.window
 	m.window = current
-	m.value = max(0, m.value-windowDiff)
+	if windowDiff == 0 {
+		return nil
+	}
+
+	var crossed []int64
+	for _, threshold := range m.thresholds {
+		distance, ok := m.distance(threshold)
+		if ok && distance <= windowDiff {
+			crossed = append(crossed, threshold)
+		}
+	}
+
+	switch {
+	case m.direction == "down" && m.wrap:
+		m.value = mod(m.value-windowDiff, m.maxValue+1)
+	case m.direction == "down":
+		m.value = max(0, m.value-windowDiff)
+	case m.wrap:
+		m.value = mod(m.value+windowDiff, m.maxValue+1)
+	case m.maxValue >= 0:
+		m.value = min(m.maxValue, m.value+windowDiff)
+	default:
+		m.value += windowDiff
+	}
+
+	return crossed
+}
+
+// distance returns the number of ticks until the value reaches the
+// threshold, it returns false if the value never reaches it.
+func (m *tickerSlot) distance(threshold int64) (int64, bool) {
+	if m.wrap {
+		var distance int64
+		if m.direction == "down" {
+			distance = mod(m.value-threshold, m.maxValue+1)
+		} else {
+			distance = mod(threshold-m.value, m.maxValue+1)
+		}
+
+		if distance == 0 {
+			distance = m.maxValue + 1
+		}
+		return distance, true
+	}
+
+	if m.direction == "down" {
+		return m.value - threshold, threshold < m.value
+	}
+
+	return threshold - m.value, threshold > m.value && (m.maxValue < 0 || threshold <= m.maxValue)
+}
+
+func mod(a, b int64) int64 {
+	return ((a % b) + b) % b
+}
+
+// schedule starts a timer for the next threshold that is reached, it must
+// be called holding the lock.
+func (m *tickerSlot) schedule() {
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+
+	next := int64(-1)
+	for _, threshold := range m.thresholds {
+		distance, ok := m.distance(threshold)
+		if ok && (next < 0 || distance < next) {
+			next = distance
+		}
+	}
+
+	if next < 0 {
+		return
+	}
+
+	reached := time.UnixMilli((m.window + next) * int64(m.rate))
+	m.timer = time.AfterFunc(time.Until(reached), m.fire)
+}
 
+func (m *tickerSlot) fire() {
+	m.mu.Lock()
+	crossed := m.tick()
+	m.schedule()
+	m.mu.Unlock()
+
+	m.notify(crossed)
+}
+
+// notify sends an async event with every threshold crossed.
+func (m *tickerSlot) notify(crossed []int64) {
+	if m.manager == nil {
+		return
+	}
+
+	for _, threshold := range crossed {
+		var sb strings.Builder
+		sb.WriteString("a")
+		sb.WriteString(m.slotID)
+		sb.WriteString(strconv.FormatInt(threshold, 10))
+		sb.WriteString("\n")
+		m.manager.Broadcast(m.slotID, sb.String(), m.CanRead)
+	}
+}
+
+func (m *tickerSlot) Read() string {
+	m.mu.Lock()
+	crossed := m.tick()
+	value := m.value
+	m.mu.Unlock()
+
+	m.notify(crossed)
+	return strconv.FormatInt(value, 10)
+}
+
+// Reset sets the ticker back to its initial value.
+func (m *tickerSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.window = currentWindowMillis(m.rate)
+	m.value = m.initial
+	m.schedule()
 	return strconv.FormatInt(m.value, 10)
 }
 
+func (m *tickerSlot) Info() []string {
+	m.mu.Lock()
+	crossed := m.tick()
+	info := []string{
+		"kind=ticker",
+		"initial_value=" + strconv.FormatInt(m.initial, 10),
+		"refresh_rate=" + strconv.Itoa(m.rate),
+		"value=" + strconv.FormatInt(m.value, 10),
+		"direction=" + m.direction,
+		"wrap=" + strconv.FormatBool(m.wrap),
+	}
+	m.mu.Unlock()
+
+	m.notify(crossed)
+	return info
+}
+
 func (m *tickerSlot) CanRead(u *auth.User) bool {
 	if len(m.users) == 0 {
 		return true
@@ -67,9 +228,14 @@ func (m *tickerSlot) Write(data string, from net.Conn) (string, error) {
 		return "", fmt.Errorf("data cannot be negative")
 	}
 
+	if m.maxValue >= 0 && dataInt > m.maxValue {
+		return "", fmt.Errorf("data cannot be bigger than the max value")
+	}
+
 	m.mu.Lock()
 	m.window = currentWindowMillis(m.rate)
 	m.value = dataInt
+	m.schedule()
 	m.mu.Unlock()
 
 	return strconv.FormatInt(dataInt, 10), nil
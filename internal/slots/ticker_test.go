@@ -2,6 +2,7 @@ package slots
 
 import (
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -194,3 +195,130 @@ func TestTickerWriteNonIntegerData(t *testing.T) {
 		t.Fatalf("Error must be returned when storing non-integer value")
 	}
 }
+
+func TestTickerInfo(t *testing.T) {
+	slot := loadTickerSlot(t)
+
+	info := slot.(Inspector).Info()
+	if info[0] != "kind=ticker" {
+		t.Fatalf("first entry must be the kind: %s", info[0])
+	}
+
+	if info[1] != "initial_value=200" {
+		t.Fatalf("unexpected initial value entry: %s", info[1])
+	}
+}
+
+func TestTickerReset(t *testing.T) {
+	slot := loadTickerSlot(t)
+
+	slot.Write("5", nil)
+
+	value := slot.(Resetter).Reset()
+	if value != "200" {
+		t.Fatalf("reset must set the initial value: %s", value)
+	}
+}
+
+func TestTickerCountUp(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "ticker")
+	v.Set("initial_value", 0)
+	v.Set("refresh_rate", 10)
+	v.Set("direction", "up")
+	v.Set("max_value", 3)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if slot.Read() != "3" {
+		t.Fatalf("ticker counting up must stop at the max value: %s", slot.Read())
+	}
+
+	if _, err := slot.Write("4", nil); err == nil {
+		t.Fatalf("values bigger than the max value must fail")
+	}
+}
+
+func TestTickerWrap(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "ticker")
+	v.Set("initial_value", 2)
+	v.Set("refresh_rate", 100)
+	v.Set("wrap", true)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	ticker := slot.(*tickerSlot)
+	ticker.mu.Lock()
+	ticker.window -= 3
+	ticker.mu.Unlock()
+
+	if slot.Read() != "2" {
+		t.Fatalf("ticker must wrap to the initial value after zero: %s", slot.Read())
+	}
+}
+
+func TestTickerThresholdEvent(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "ticker")
+	v.Set("initial_value", 3)
+	v.Set("refresh_rate", 10)
+	v.Set("thresholds", []int{0})
+
+	events := make(chan string, 10)
+	conn := &MockConnectionManager{
+		BroadcastFunc: func(message string) (string, error) {
+			events <- message
+			return "", nil
+		},
+	}
+
+	_, err := GetSlot(v, conn, "012")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	select {
+	case event := <-events:
+		if event != "a0120\n" {
+			t.Fatalf("unexpected event: %s", event)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("event must be sent when the threshold is reached")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("threshold must be notified once: %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTickerInvalidDirection(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "ticker")
+	v.Set("initial_value", 3)
+	v.Set("refresh_rate", 10)
+	v.Set("direction", "sideways")
+
+	if _, err := GetSlot(v, nil, ""); err == nil {
+		t.Fatalf("Slot must return error for invalid direction")
+	}
+
+	v.Set("direction", "up")
+	v.Set("wrap", true)
+	if _, err := GetSlot(v, nil, ""); err == nil {
+		t.Fatalf("Slot must return error when wrapping without max value")
+	}
+}
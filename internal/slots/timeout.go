@@ -3,28 +3,107 @@ package slots
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/connectionmanager"
+	"github.com/dankomiocevic/ghoti/internal/errs"
 )
 
+// SupportedOwnerModes are the ways a timeout_memory slot identifies its owner:
+// by the connection that wrote it, by the logged in user or by the session
+// token provided by the client.
+var SupportedOwnerModes = map[string]bool{
+	"connection": true,
+	"user":       true,
+	"session":    true,
+}
+
+// ErrNotOwner is returned when a client tries to modify a slot that is owned
+// by another client.
+var ErrNotOwner = errors.New("permission denied to write slot")
+
+// ErrQueueFull is returned by Acquire when there are too many clients
+// waiting for the slot.
+var ErrQueueFull = errors.New("too many clients waiting for the slot")
+
+// ownerKey identifies the owner of a slot, only one of the fields is set
+// depending on the owner mode.
+type ownerKey struct {
+	conn net.Conn
+	name string
+}
+
+// waiter is a client waiting in line to own the slot, the data is written
+// when the slot is handed over to it.
+type waiter struct {
+	key  ownerKey
+	id   string
+	data string
+}
+
 type timeoutSlot struct {
-	users   map[string]string
-	value   string
-	owner   net.Conn
-	timeout time.Duration
-	ttl     time.Time
-	mu      sync.RWMutex
+	users      map[string]string
+	value      string
+	owner      ownerKey
+	mode       string
+	timeout    time.Duration
+	ttl        time.Time
+	waiters    []waiter
+	maxWaiters int
+	timer      *time.Timer
+	conn       connectionmanager.ConnectionManager
+	id         string
+	notifier   *notifier
+	versions   versions
+	mu         sync.RWMutex
 }
 
-func newTimeoutSlot(timeout int, users map[string]string) (*timeoutSlot, error) {
+func newTimeoutSlot(timeout int, mode string, maxWaiters int, users map[string]string, conn connectionmanager.ConnectionManager, id string) (*timeoutSlot, error) {
 	if timeout < 1 {
 		return nil, fmt.Errorf("timeout value in timeout_memory slot must be bigger than zero")
 	}
 
-	return &timeoutSlot{value: "", timeout: time.Duration(timeout) * time.Second, ttl: time.Time{}, users: users}, nil
+	if !SupportedOwnerModes[mode] {
+		return nil, fmt.Errorf("owner_mode value is invalid on timeout_memory slot: %s", mode)
+	}
+
+	if maxWaiters < 0 {
+		return nil, fmt.Errorf("max_waiters value in timeout_memory slot cannot be negative")
+	}
+
+	return &timeoutSlot{
+		value:      "",
+		mode:       mode,
+		timeout:    time.Duration(timeout) * time.Second,
+		ttl:        time.Time{},
+		maxWaiters: maxWaiters,
+		users:      users,
+		conn:       conn,
+		id:         id,
+	}, nil
+}
+
+// keyFor returns the key that identifies the caller as owner of the slot.
+func (m *timeoutSlot) keyFor(caller Caller) (ownerKey, error) {
+	switch m.mode {
+	case "user":
+		if caller.User == "" {
+			return ownerKey{}, errors.New("user must be logged in to own the slot")
+		}
+		return ownerKey{name: caller.User}, nil
+	case "session":
+		if caller.Session == "" {
+			return ownerKey{}, errors.New("session must be set to own the slot")
+		}
+		return ownerKey{name: caller.Session}, nil
+	default:
+		return ownerKey{conn: caller.Conn}, nil
+	}
 }
 
 func (m *timeoutSlot) Read() string {
@@ -34,28 +113,349 @@ func (m *timeoutSlot) Read() string {
 	return m.value
 }
 
+// Peek returns the value without the changes of a batch that is running.
+func (m *timeoutSlot) Peek() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.versions.visible(m.value)
+}
+
+func (m *timeoutSlot) Since(version uint64) (uint64, string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number, changed := m.versions.since(version)
+	return number, m.versions.visible(m.value), changed
+}
+
 func (m *timeoutSlot) Write(data string, from net.Conn) (string, error) {
+	return m.WriteAs(data, Caller{Conn: from})
+}
+
+func (m *timeoutSlot) WriteAs(data string, caller Caller) (string, error) {
+	key, err := m.keyFor(caller)
+	if err != nil {
+		return "", err
+	}
+
 	timeNow := time.Now()
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if timeNow.After(m.ttl) {
-		m.owner = from
+	m.handOverExpired(timeNow)
+	if timeNow.After(m.ttl) || key == m.owner {
+		m.owner = key
 		m.value = data
 		m.ttl = timeNow.Add(m.timeout)
+		m.written()
 
 		return m.value, nil
 	}
 
-	if from == m.owner {
+	return "", ErrNotOwner
+}
+
+// Release gives up the ownership of the slot keeping its value,
+// so any other client can write it.
+func (m *timeoutSlot) Release(caller Caller) (string, error) {
+	key, err := m.keyFor(caller)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Now().After(m.ttl) || key != m.owner {
+		return "", ErrNotOwner
+	}
+
+	m.owner = ownerKey{}
+	m.ttl = time.Time{}
+	value := m.value
+	m.notifier.notify("release", value)
+	m.handOver(time.Now())
+	return value, nil
+}
+
+// Renew extends the ownership of the slot for another timeout period
+// without modifying its value.
+func (m *timeoutSlot) Renew(caller Caller) (string, error) {
+	key, err := m.keyFor(caller)
+	if err != nil {
+		return "", err
+	}
+
+	timeNow := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if timeNow.After(m.ttl) || key != m.owner {
+		return "", ErrNotOwner
+	}
+
+	m.ttl = timeNow.Add(m.timeout)
+	m.schedule()
+	return m.value, nil
+}
+
+func (m *timeoutSlot) CompareAndSwap(expected string, data string, caller Caller) (string, error) {
+	key, err := m.keyFor(caller)
+	if err != nil {
+		return "", err
+	}
+
+	timeNow := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handOverExpired(timeNow)
+	expired := timeNow.After(m.ttl)
+	if !expired && key != m.owner {
+		return "", ErrNotOwner
+	}
+
+	if m.value != expected {
+		return "", ErrValueMismatch
+	}
+
+	m.owner = key
+	m.value = data
+	m.ttl = timeNow.Add(m.timeout)
+	m.written()
+
+	return m.value, nil
+}
+
+// Acquire writes the slot if it is free or owned by the caller, otherwise
+// the caller waits in line until the slot is released or the owner times out.
+func (m *timeoutSlot) Acquire(data string, caller Caller) (string, int, error) {
+	key, err := m.keyFor(caller)
+	if err != nil {
+		return "", 0, err
+	}
+
+	timeNow := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handOverExpired(timeNow)
+	if timeNow.After(m.ttl) || key == m.owner {
+		m.owner = key
 		m.value = data
 		m.ttl = timeNow.Add(m.timeout)
+		m.written()
 
-		return m.value, nil
+		return m.value, 0, nil
+	}
+
+	for i, w := range m.waiters {
+		if w.key == key {
+			m.waiters[i] = waiter{key: key, id: caller.ID, data: data}
+			return "", i + 1, nil
+		}
+	}
+
+	if len(m.waiters) >= m.maxWaiters {
+		return "", 0, ErrQueueFull
+	}
+
+	m.waiters = append(m.waiters, waiter{key: key, id: caller.ID, data: data})
+	if len(m.waiters) == 1 {
+		m.schedule()
 	}
+	return "", len(m.waiters), nil
+}
+
+// handOverExpired gives the slot to the next waiter when the owner timed out.
+func (m *timeoutSlot) handOverExpired(timeNow time.Time) {
+	if len(m.waiters) > 0 && timeNow.After(m.ttl) {
+		m.handOver(timeNow)
+	}
+}
+
+// handOver gives the slot to the first waiter, the waiter is notified with an
+// async event containing its value that is sent without holding the lock.
+func (m *timeoutSlot) handOver(timeNow time.Time) {
+	if len(m.waiters) == 0 {
+		return
+	}
+
+	next := m.waiters[0]
+	m.waiters = m.waiters[1:]
+
+	previous := m.value
+	m.owner = next.key
+	m.value = next.data
+	m.ttl = timeNow.Add(m.timeout)
+	m.written()
+
+	if m.conn != nil {
+		go m.deliver(next, previous, m.versions.number)
+	}
+}
+
+// deliver notifies the waiter that the slot was handed over to it. When the
+// event could not be queued the waiter is not connected anymore, the value
+// before the hand over is restored and the slot is given to the next waiter.
+// Any other error keeps the waiter as owner because the event could still
+// reach it, the slot is handed over when its ownership times out.
+func (m *timeoutSlot) deliver(next waiter, previous string, version uint64) {
+	err := m.conn.Send(next.id, "a"+m.id+next.data+"\n")
+	if err == nil {
+		return
+	}
+
+	if _, ok := err.(errs.PermanentError); !ok {
+		slog.Debug("Could not confirm the hand over of timeout slot",
+			slog.String("slot", m.id),
+			slog.String("id", next.id),
+			slog.Any("error", err),
+		)
+		return
+	}
+
+	slog.Debug("Skipping waiter of timeout slot",
+		slog.String("slot", m.id),
+		slog.String("id", next.id),
+		slog.Any("error", err),
+	)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.versions.number != version {
+		// The new owner was never notified but the slot changed already
+		return
+	}
+
+	m.owner = ownerKey{}
+	m.value = previous
+	m.ttl = time.Time{}
+	m.versions.bump()
+	m.notifier.notify("write", m.value)
+	m.handOver(time.Now())
+}
+
+// written notifies that the slot was written and starts the timer for the
+// new ownership, it must be called holding the lock.
+func (m *timeoutSlot) written() {
+	m.versions.bump()
+	m.notifier.notify("write", m.value)
+	m.schedule()
+}
 
-	return "", errors.New("permission denied to write slot")
+// schedule starts a timer to hand over the slot when the owner times out,
+// the timer is only needed while there are clients waiting or to notify
+// that the ownership expired.
+func (m *timeoutSlot) schedule() {
+	if len(m.waiters) == 0 && !m.notifier.enabled() {
+		return
+	}
+
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(time.Until(m.ttl), m.expire)
+}
+
+func (m *timeoutSlot) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ttl.IsZero() {
+		// The slot was released
+		return
+	}
+
+	timeNow := time.Now()
+	if !timeNow.After(m.ttl) {
+		// The ownership was renewed, wait for the new timeout
+		m.schedule()
+		return
+	}
+
+	m.notifier.notify("expire", m.value)
+	m.ttl = time.Time{}
+	m.handOver(timeNow)
+}
+
+// Save returns a function that commits or restores the value and the owner
+// of the slot. The slot is handed over first if the owner timed out, so the
+// waiters are not changed by the commands that can be undone.
+func (m *timeoutSlot) Save() func(bool) {
+	m.mu.Lock()
+	m.handOverExpired(time.Now())
+	value, owner, ttl := m.value, m.owner, m.ttl
+	m.versions.hold(value)
+	m.notifier.hold()
+	m.mu.Unlock()
+
+	return func(commit bool) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		defer m.notifier.release(commit)
+		defer m.versions.release(commit)
+		if commit || (m.value == value && m.owner == owner && m.ttl.Equal(ttl)) {
+			return
+		}
+
+		m.value = value
+		m.owner = owner
+		m.ttl = ttl
+		m.written()
+	}
+}
+
+// Reset clears the value and releases the ownership of the slot, the slot
+// is handed over to the next client waiting for it.
+func (m *timeoutSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value = ""
+	m.owner = ownerKey{}
+	m.ttl = time.Time{}
+	m.versions.bump()
+	m.notifier.notify("reset", "")
+	m.handOver(time.Now())
+	return m.value
+}
+
+func (m *timeoutSlot) Info() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	remaining := max(0, time.Until(m.ttl))
+	owned := remaining > 0
+	owner := ""
+	if owned {
+		switch m.mode {
+		case "user":
+			owner = m.owner.name
+		case "connection":
+			if m.owner.conn != nil && m.owner.conn.RemoteAddr() != nil {
+				owner = m.owner.conn.RemoteAddr().String()
+			}
+		}
+	}
+
+	return []string{
+		"kind=timeout_memory",
+		"timeout=" + strconv.FormatInt(int64(m.timeout/time.Second), 10),
+		"owner_mode=" + m.mode,
+		"owned=" + strconv.FormatBool(owned),
+		"owner=" + owner,
+		"ttl_ms=" + strconv.FormatInt(remaining.Milliseconds(), 10),
+		"waiters=" + strconv.Itoa(len(m.waiters)),
+		"notify=" + strconv.FormatBool(m.notifier.enabled()),
+	}
 }
 
 func (m *timeoutSlot) CanRead(u *auth.User) bool {
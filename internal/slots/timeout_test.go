@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/dankomiocevic/ghoti/internal/auth"
+	"github.com/dankomiocevic/ghoti/internal/errs"
 )
 
 func loadTimeoutSlot(t *testing.T) Slot {
@@ -144,3 +145,305 @@ func TestMultipleWrites(t *testing.T) {
 		t.Fatalf("Writing before timeout should fail")
 	}
 }
+
+func TestTimeoutReset(t *testing.T) {
+	slot := loadTimeoutSlot(t)
+	owner, other := net.Pipe()
+	defer owner.Close()
+	defer other.Close()
+
+	slot.Write("owned", owner)
+	if _, err := slot.Write("other", other); err == nil {
+		t.Fatalf("slot must be owned before reset")
+	}
+
+	slot.(Resetter).Reset()
+	if slot.Read() != "" {
+		t.Fatalf("reset must clear the value")
+	}
+
+	if _, err := slot.Write("other", other); err != nil {
+		t.Fatalf("slot must be released after reset: %s", err)
+	}
+}
+
+func loadOwnedTimeoutSlot(t *testing.T, mode string) Slot {
+	v := viper.New()
+
+	v.Set("kind", "timeout_memory")
+	v.Set("timeout", 1)
+	v.Set("owner_mode", mode)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	return slot
+}
+
+func TestTimeoutInvalidOwnerMode(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "timeout_memory")
+	v.Set("timeout", 1)
+	v.Set("owner_mode", "pepe")
+
+	_, err := GetSlot(v, nil, "")
+	if err == nil {
+		t.Fatalf("Slot must return error for invalid owner mode")
+	}
+}
+
+func TestTimeoutOwnedByUser(t *testing.T) {
+	_, first := net.Pipe()
+	_, second := net.Pipe()
+	slot := loadOwnedTimeoutSlot(t, "user")
+
+	_, err := WriteAs(slot, "Hello!", Caller{Conn: first, User: "pepe"})
+	if err != nil {
+		t.Fatalf("error writing slot: %s", err)
+	}
+
+	_, err = WriteAs(slot, "Again!", Caller{Conn: second, User: "pepe"})
+	if err != nil {
+		t.Fatalf("the same user must own the slot from another connection: %s", err)
+	}
+
+	_, err = WriteAs(slot, "Other!", Caller{Conn: first, User: "bobby"})
+	if err == nil {
+		t.Fatalf("another user must not write the slot")
+	}
+
+	_, err = slot.Write("Anonymous!", first)
+	if err == nil {
+		t.Fatalf("anonymous clients must not own the slot")
+	}
+}
+
+func TestTimeoutOwnedBySession(t *testing.T) {
+	_, first := net.Pipe()
+	_, second := net.Pipe()
+	slot := loadOwnedTimeoutSlot(t, "session")
+
+	_, err := WriteAs(slot, "Hello!", Caller{Conn: first, Session: "abc"})
+	if err != nil {
+		t.Fatalf("error writing slot: %s", err)
+	}
+
+	_, err = WriteAs(slot, "Again!", Caller{Conn: second, Session: "abc"})
+	if err != nil {
+		t.Fatalf("the same session must own the slot after reconnecting: %s", err)
+	}
+
+	_, err = WriteAs(slot, "Other!", Caller{Conn: second, Session: "xyz"})
+	if err == nil {
+		t.Fatalf("another session must not write the slot")
+	}
+}
+
+func TestTimeoutRelease(t *testing.T) {
+	_, owner := net.Pipe()
+	_, other := net.Pipe()
+	slot := loadTimeoutSlot(t)
+	owned := slot.(Owned)
+
+	slot.Write("Hello!", owner)
+
+	_, err := owned.Release(Caller{Conn: other})
+	if err != ErrNotOwner {
+		t.Fatalf("only the owner can release the slot: %v", err)
+	}
+
+	value, err := owned.Release(Caller{Conn: owner})
+	if err != nil {
+		t.Fatalf("error releasing slot: %s", err)
+	}
+
+	if value != "Hello!" {
+		t.Fatalf("release must keep the value: %s", value)
+	}
+
+	_, err = slot.Write("Mine now!", other)
+	if err != nil {
+		t.Fatalf("slot must be free after release: %s", err)
+	}
+}
+
+func TestTimeoutRenew(t *testing.T) {
+	_, owner := net.Pipe()
+	_, other := net.Pipe()
+	slot := loadTimeoutSlot(t)
+	owned := slot.(Owned)
+
+	slot.Write("Hello!", owner)
+
+	time.Sleep(600 * time.Millisecond)
+	_, err := owned.Renew(Caller{Conn: owner})
+	if err != nil {
+		t.Fatalf("error renewing slot: %s", err)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	_, err = slot.Write("Other!", other)
+	if err == nil {
+		t.Fatalf("renewed slot must still be owned")
+	}
+
+	_, err = owned.Renew(Caller{Conn: other})
+	if err != ErrNotOwner {
+		t.Fatalf("only the owner can renew the slot: %v", err)
+	}
+}
+
+func TestTimeoutAcquireQueue(t *testing.T) {
+	_, owner := net.Pipe()
+	_, second := net.Pipe()
+	_, third := net.Pipe()
+	slot := loadTimeoutSlot(t)
+	waiter := slot.(Waiter)
+
+	value, position, err := waiter.Acquire("First", Caller{Conn: owner})
+	if err != nil || position != 0 || value != "First" {
+		t.Fatalf("free slot must be acquired: %s %d %v", value, position, err)
+	}
+
+	_, position, _ = waiter.Acquire("Second", Caller{Conn: second})
+	if position != 1 {
+		t.Fatalf("second client must be first in line: %d", position)
+	}
+
+	_, position, _ = waiter.Acquire("Third", Caller{Conn: third})
+	if position != 2 {
+		t.Fatalf("third client must be second in line: %d", position)
+	}
+
+	// Writing a free slot must not skip the line
+	slot.(Owned).Release(Caller{Conn: owner})
+	if slot.Read() != "Second" {
+		t.Fatalf("slot must be handed over to the first in line: %s", slot.Read())
+	}
+
+	_, err = slot.Write("Skip", third)
+	if err == nil {
+		t.Fatalf("only the new owner can write the slot")
+	}
+
+	// The owner times out and the slot is handed over without any write
+	time.Sleep(1100 * time.Millisecond)
+	if slot.Read() != "Third" {
+		t.Fatalf("slot must be handed over after the timeout: %s", slot.Read())
+	}
+}
+
+func TestTimeoutAcquireSkipsDisconnected(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "timeout_memory")
+	v.Set("timeout", 10)
+
+	notified := make(chan string, 10)
+	conn := &MockConnectionManager{
+		SendFunc: func(id string, message string) error {
+			if id == "gone" {
+				return errs.PermanentError{Err: "Connection not found"}
+			}
+			notified <- id + " " + message
+			return nil
+		},
+	}
+
+	slot, err := GetSlot(v, conn, "001")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	waiter := slot.(Waiter)
+
+	_, owner := net.Pipe()
+	_, gone := net.Pipe()
+	_, other := net.Pipe()
+	waiter.Acquire("First", Caller{ID: "owner", Conn: owner})
+	waiter.Acquire("Gone", Caller{ID: "gone", Conn: gone})
+	waiter.Acquire("Other", Caller{ID: "other", Conn: other})
+
+	slot.(Owned).Release(Caller{ID: "owner", Conn: owner})
+	select {
+	case message := <-notified:
+		if message != "other a001Other\n" {
+			t.Fatalf("unexpected notification: %s", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the next waiter must be notified")
+	}
+
+	if slot.Read() != "Other" {
+		t.Fatalf("disconnected waiters must be skipped: %s", slot.Read())
+	}
+}
+
+func TestTimeoutAcquireUnconfirmedDelivery(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "timeout_memory")
+	v.Set("timeout", 10)
+
+	sent := make(chan string, 10)
+	conn := &MockConnectionManager{
+		SendFunc: func(id string, message string) error {
+			sent <- id
+			return errs.TranscientError{Err: "Timeout waiting for callback"}
+		},
+	}
+
+	slot, err := GetSlot(v, conn, "001")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	waiter := slot.(Waiter)
+
+	_, owner := net.Pipe()
+	_, slow := net.Pipe()
+	_, other := net.Pipe()
+	waiter.Acquire("First", Caller{ID: "owner", Conn: owner})
+	waiter.Acquire("Slow", Caller{ID: "slow", Conn: slow})
+	waiter.Acquire("Other", Caller{ID: "other", Conn: other})
+
+	slot.(Owned).Release(Caller{ID: "owner", Conn: owner})
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("the next waiter must be notified")
+	}
+
+	// The event could still reach the waiter, so it keeps the slot
+	time.Sleep(50 * time.Millisecond)
+	if slot.Read() != "Slow" {
+		t.Fatalf("waiters must keep the slot when the delivery is unconfirmed: %s", slot.Read())
+	}
+
+	_, err = slot.(Owned).Renew(Caller{ID: "slow", Conn: slow})
+	if err != nil {
+		t.Fatalf("the waiter must own the slot: %s", err)
+	}
+}
+
+func TestTimeoutAcquireQueueFull(t *testing.T) {
+	v := viper.New()
+	v.Set("kind", "timeout_memory")
+	v.Set("timeout", 10)
+	v.Set("max_waiters", 1)
+
+	slot, err := GetSlot(v, nil, "")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+	waiter := slot.(Waiter)
+
+	_, owner := net.Pipe()
+	_, second := net.Pipe()
+	_, third := net.Pipe()
+	waiter.Acquire("First", Caller{Conn: owner})
+	waiter.Acquire("Second", Caller{Conn: second})
+
+	_, _, err = waiter.Acquire("Third", Caller{Conn: third})
+	if err != ErrQueueFull {
+		t.Fatalf("queue must be full: %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package slots
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"net"
 	"strconv"
 	"sync"
@@ -10,18 +12,51 @@ import (
 	"github.com/dankomiocevic/ghoti/internal/auth"
 )
 
+// SupportedRefills are the ways a token bucket adds tokens: all the tokens
+// of a period at once when the period starts, or continuously spread along
+// the period.
+var SupportedRefills = map[string]bool{
+	"interval":   true,
+	"continuous": true,
+}
+
+// ErrNotEnoughTokens is returned by Take when the bucket does not have the
+// requested number of tokens.
+var ErrNotEnoughTokens = errors.New("not enough tokens in the bucket")
+
+// ErrNotTaken is returned by Refund when the caller did not take any of the
+// tokens it tries to return.
+var ErrNotTaken = errors.New("the tokens were not taken by the caller")
+
+// held are the tokens taken by a client that it can still return, the
+// tokens can be returned until a period passes since the last take.
+type held struct {
+	tokens int
+	last   time.Time
+}
+
 type tokenBucketSlot struct {
 	users        map[string]string
 	value        int
 	size         int
-	period       int64
+	period       time.Duration
+	periodName   string
+	refillMode   string
 	rate         int
 	window       int64
+	last         time.Time
 	tokensPerReq int
+	parent       limiter
+	parentID     string
+	shadow       *shadowMode
+	notifier     *notifier
+	taken        int64
+	holders      map[string]held
+	pruned       time.Time
 	mu           sync.Mutex
 }
 
-func newTokenBucketSlot(periodString string, bucketSize, refreshRate, tokensPerReq int, users map[string]string) (*tokenBucketSlot, error) {
+func newTokenBucketSlot(periodString string, refillMode string, bucketSize, refreshRate, tokensPerReq int, users map[string]string) (*tokenBucketSlot, error) {
 	if bucketSize < 1 {
 		return nil, fmt.Errorf("bucket size must be bigger than zero")
 	}
@@ -42,40 +77,335 @@ func newTokenBucketSlot(periodString string, bucketSize, refreshRate, tokensPerR
 		return nil, fmt.Errorf("tokens per request cannot be zero")
 	}
 
-	var period int64
+	period, err := parsePeriod(periodString)
+	if err != nil {
+		return nil, err
+	}
+
+	if !SupportedRefills[refillMode] {
+		return nil, fmt.Errorf("refill value is invalid on token_bucket slot: %s", refillMode)
+	}
+
+	if refillMode == "continuous" && period/time.Duration(refreshRate) == 0 {
+		return nil, fmt.Errorf("refresh rate is too high for the period on continuous refill")
+	}
+
+	return &tokenBucketSlot{
+		value:        refreshRate,
+		size:         bucketSize,
+		period:       period,
+		periodName:   periodString,
+		refillMode:   refillMode,
+		rate:         refreshRate,
+		window:       currentWindow(period),
+		last:         time.Now(),
+		tokensPerReq: tokensPerReq,
+		users:        users,
+		holders:      make(map[string]held),
+		pruned:       time.Now(),
+	}, nil
+}
+
+// parsePeriod parses the refill period of a token bucket, it can be one of
+// second, minute or hour or a duration like 250ms or 15s.
+func parsePeriod(periodString string) (time.Duration, error) {
 	switch periodString {
 	case "second":
-		period = 1
+		return time.Second, nil
 	case "minute":
-		period = 60
+		return time.Minute, nil
 	case "hour":
-		period = 3600
-	default:
-		return nil, fmt.Errorf("period value is invalid on token_bucket slot: %s", periodString)
+		return time.Hour, nil
 	}
 
-	return &tokenBucketSlot{value: refreshRate, size: bucketSize, period: period, rate: refreshRate, window: currentWindow(period), tokensPerReq: tokensPerReq, users: users}, nil
+	period, err := time.ParseDuration(periodString)
+	if err != nil || period < time.Millisecond {
+		return 0, fmt.Errorf("period value is invalid on token_bucket slot: %s", periodString)
+	}
+
+	return period, nil
 }
 
-func currentWindow(period int64) int64 {
-	currentTime := time.Now().Unix()
-	return currentTime / period
+func currentWindow(period time.Duration) int64 {
+	return time.Now().UnixNano() / int64(period)
 }
 
-func (m *tokenBucketSlot) Read() string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// refill adds the tokens generated since the last refill, it must be called
+// holding the lock.
+func (m *tokenBucketSlot) refill() {
+	if m.refillMode == "continuous" {
+		m.refillContinuous()
+		return
+	}
 
 	current := currentWindow(m.period)
 	if current != m.window {
 		m.window = current
 		m.value = min(m.size, m.value+m.rate)
 	}
+}
+
+// refillContinuous adds one token every period divided by the rate, the time
+// of the tokens not generated yet is kept for the next refill.
+func (m *tokenBucketSlot) refillContinuous() {
+	timeNow := time.Now()
+	if m.value >= m.size {
+		m.last = timeNow
+		return
+	}
+
+	perToken := m.period / time.Duration(m.rate)
+	tokens := int(timeNow.Sub(m.last) / perToken)
+	if tokens == 0 {
+		return
+	}
+
+	m.value = min(m.size, m.value+tokens)
+	m.last = m.last.Add(time.Duration(tokens) * perToken)
+	if m.value == m.size {
+		m.last = timeNow
+	}
+}
+
+func (m *tokenBucketSlot) Read() string {
+	response, _ := m.Allow()
+	return response
+}
+
+// Allow takes the tokens of a request, the request is allowed when at least
+// one token is granted.
+func (m *tokenBucketSlot) Allow() (string, bool) {
+	allowed, _ := m.takeTokens(m.tokensPerReq, true, true)
+	return strconv.Itoa(allowed), allowed > 0
+}
+
+// Take removes the given number of tokens from the bucket, no tokens are
+// taken when the bucket does not have all of them. The tokens are kept as
+// held by the caller, so it can return the ones it does not use.
+func (m *tokenBucketSlot) Take(tokens int, caller Caller) (int, error) {
+	if tokens < 1 || tokens > m.size {
+		return 0, fmt.Errorf("tokens must be between 1 and the bucket size")
+	}
+
+	allowed, granted := m.takeTokens(tokens, false, true)
+	if allowed == 0 {
+		return 0, ErrNotEnoughTokens
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Shadow slots allow requests without taking the tokens, those tokens
+	// cannot be returned
+	m.prune()
+	if granted > 0 {
+		key := holderKey(caller)
+		m.holders[key] = held{tokens: m.holders[key].tokens + granted, last: time.Now()}
+	}
+	return allowed, nil
+}
+
+// holderKey identifies the client that holds the tokens, by its session when
+// it has one so the tokens can be returned from another connection.
+func holderKey(caller Caller) string {
+	if caller.Session != "" {
+		return "session:" + caller.Session
+	}
+
+	return "conn:" + caller.ID
+}
+
+// prune forgets the tokens held by clients that did not take tokens for a
+// whole period, so disconnected clients are not kept forever. It runs at
+// most once per period and must be called holding the lock.
+func (m *tokenBucketSlot) prune() {
+	timeNow := time.Now()
+	if timeNow.Sub(m.pruned) < m.period {
+		return
+	}
+
+	m.pruned = timeNow
+	maps.DeleteFunc(m.holders, func(_ string, h held) bool {
+		return timeNow.Sub(h.last) >= m.period
+	})
+}
+
+func (m *tokenBucketSlot) take(tokens int, partial bool) int {
+	allowed, _ := m.takeTokens(tokens, partial, false)
+	return allowed
+}
+
+// takeTokens takes the tokens from the bucket and its parents, the tokens
+// taken by the clients of the slot are counted so they can be returned when
+// a batch is rolled back. It returns the tokens allowed and the tokens taken,
+// shadow slots allow the whole request and count it as denied when not all
+// the tokens could be taken.
+func (m *tokenBucketSlot) takeTokens(tokens int, partial bool, direct bool) (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refill()
+	granted := tokens
+	if partial {
+		granted = min(tokens, m.value)
+	} else if m.value < tokens {
+		granted = 0
+	}
+
+	if m.parent != nil && granted > 0 {
+		granted = m.parent.take(granted, partial)
+	}
+
+	m.value -= granted
+	if direct {
+		m.taken += int64(granted)
+	}
+	if granted > 0 && m.value == 0 {
+		m.notifier.notify("exhausted", "")
+	}
+	if granted < tokens && m.shadow != nil {
+		m.shadow.deny()
+		return tokens, granted
+	}
+	return granted, granted
+}
+
+func (m *tokenBucketSlot) refund(tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refill()
+	m.value = min(m.size, m.value+tokens)
+	if m.parent != nil {
+		m.parent.refund(tokens)
+	}
+}
+
+func (m *tokenBucketSlot) setParent(parent limiter, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parent = parent
+	m.parentID = id
+}
+
+func (m *tokenBucketSlot) parentLimiter() limiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.parent
+}
+
+// Refund returns unused tokens to the bucket, callers can only return the
+// tokens they took and the bucket never holds more tokens than its size. It
+// returns the number of tokens accepted.
+func (m *tokenBucketSlot) Refund(tokens int, caller Caller) (int, error) {
+	if tokens < 1 || tokens > m.size {
+		return 0, fmt.Errorf("tokens must be between 1 and the bucket size")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	key := holderKey(caller)
+	h, ok := m.holders[key]
+	if !ok {
+		return 0, ErrNotTaken
+	}
+
+	returned := min(tokens, h.tokens)
+	h.tokens -= returned
+	if h.tokens == 0 {
+		delete(m.holders, key)
+	} else {
+		m.holders[key] = h
+	}
+
+	m.refill()
+	accepted := min(returned, m.size-m.value)
+	m.value += accepted
+	m.taken -= int64(accepted)
+	if m.parent != nil && accepted > 0 {
+		m.parent.refund(accepted)
+	}
+	return accepted, nil
+}
+
+// Save returns a function that commits the tokens taken by the clients of
+// the slot since it was called, or returns them to the bucket and takes
+// again the tokens they refunded. The tokens held by the clients are
+// restored too.
+func (m *tokenBucketSlot) Save() func(bool) {
+	m.mu.Lock()
+	taken := m.taken
+	holders := maps.Clone(m.holders)
+	m.notifier.hold()
+	m.mu.Unlock()
+
+	return func(commit bool) {
+		m.mu.Lock()
+		m.notifier.release(commit)
+		if commit {
+			m.mu.Unlock()
+			return
+		}
+
+		diff := m.taken - taken
+		m.taken = taken
+		m.holders = holders
+		m.mu.Unlock()
+
+		if diff > 0 {
+			m.refund(int(diff))
+		} else if diff < 0 {
+			m.take(int(-diff), true)
+		}
+	}
+}
+
+// Reset refills the bucket up to its size.
+func (m *tokenBucketSlot) Reset() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.window = currentWindow(m.period)
+	m.last = time.Now()
+	m.value = m.size
+	clear(m.holders)
+	return strconv.Itoa(m.value)
+}
+
+// nextRefill returns the time until the next token is added.
+func (m *tokenBucketSlot) nextRefill() time.Duration {
+	if m.refillMode == "continuous" {
+		if m.value >= m.size {
+			return 0
+		}
+		return m.last.Add(m.period / time.Duration(m.rate)).Sub(time.Now())
+	}
+
+	return time.Unix(0, (m.window+1)*int64(m.period)).Sub(time.Now())
+}
+
+func (m *tokenBucketSlot) Info() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	retVal := min(m.value, m.tokensPerReq)
+	m.refill()
 
-	m.value -= retVal
-	return strconv.Itoa(retVal)
+	return append([]string{
+		"kind=token_bucket",
+		"bucket_size=" + strconv.Itoa(m.size),
+		"period=" + m.periodName,
+		"refresh_rate=" + strconv.Itoa(m.rate),
+		"tokens_per_req=" + strconv.Itoa(m.tokensPerReq),
+		"tokens=" + strconv.Itoa(m.value),
+		"next_refill_ms=" + strconv.FormatInt(m.nextRefill().Milliseconds(), 10),
+		"refill=" + m.refillMode,
+		"parent=" + m.parentID,
+		"notify=" + strconv.FormatBool(m.notifier.enabled()),
+	}, m.shadow.info()...)
 }
 
 func (m *tokenBucketSlot) CanRead(u *auth.User) bool {
@@ -1,6 +1,7 @@
 package slots
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -360,7 +361,7 @@ func TestTokenBucketWithMinutePeriod(t *testing.T) {
 	}
 
 	tokenSlot := slot.(*tokenBucketSlot)
-	if tokenSlot.period != 60 {
+	if tokenSlot.period != 60*time.Second {
 		t.Fatalf("Period should be 60 seconds for minute period, got: %d", tokenSlot.period)
 	}
 }
@@ -380,7 +381,7 @@ func TestTokenBucketWithHourPeriod(t *testing.T) {
 	}
 
 	tokenSlot := slot.(*tokenBucketSlot)
-	if tokenSlot.period != 3600 {
+	if tokenSlot.period != 3600*time.Second {
 		t.Fatalf("Period should be 3600 seconds for hour period, got: %d", tokenSlot.period)
 	}
 }
@@ -388,7 +389,7 @@ func TestTokenBucketWithHourPeriod(t *testing.T) {
 func TestTokenBucketWithInvalidPeriod(t *testing.T) {
 	users := make(map[string]string)
 
-	_, err := newTokenBucketSlot("invalid", 100, 50, 10, users)
+	_, err := newTokenBucketSlot("invalid", "interval", 100, 50, 10, users)
 	if err == nil {
 		t.Fatalf("Expected error when creating token bucket with invalid period")
 	}
@@ -402,7 +403,7 @@ func TestTokenBucketWithInvalidPeriod(t *testing.T) {
 func TokenBucketNegativeTokensPerRequest(t *testing.T) {
 	users := make(map[string]string)
 
-	_, err := newTokenBucketSlot("second", 100, 50, -5, users)
+	_, err := newTokenBucketSlot("second", "interval", 100, 50, -5, users)
 	if err == nil {
 		t.Fatalf("Expected error when creating token bucket with negative tokens per request")
 	}
@@ -415,7 +416,7 @@ func TokenBucketNegativeTokensPerRequest(t *testing.T) {
 
 func TokenBucketEmptyUserMap(t *testing.T) {
 	// Create a token bucket with an empty users map
-	slot, err := newTokenBucketSlot("second", 100, 50, 10, map[string]string{})
+	slot, err := newTokenBucketSlot("second", "interval", 100, 50, 10, map[string]string{})
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -432,3 +433,231 @@ func TokenBucketEmptyUserMap(t *testing.T) {
 		t.Fatalf("Expected no write permission regardless of users map")
 	}
 }
+
+func TestTokenBucketInfo(t *testing.T) {
+	slot := loadBucketSlot(t)
+
+	info := slot.(Inspector).Info()
+	if info[0] != "kind=token_bucket" {
+		t.Fatalf("first entry must be the kind: %s", info[0])
+	}
+
+	if info[5] != "tokens=100" {
+		t.Fatalf("unexpected tokens entry: %s", info[5])
+	}
+
+	// Requesting the information must not take tokens
+	info = slot.(Inspector).Info()
+	if info[5] != "tokens=100" {
+		t.Fatalf("info must not consume tokens: %s", info[5])
+	}
+}
+
+func TestTokenBucketReset(t *testing.T) {
+	slot := loadBucketSlot(t)
+
+	for i := 0; i < 5; i++ {
+		slot.Read()
+	}
+
+	value := slot.(Resetter).Reset()
+	if value != "200" {
+		t.Fatalf("reset must refill the bucket: %s", value)
+	}
+
+	if slot.Read() != "20" {
+		t.Fatalf("tokens must be available after reset")
+	}
+}
+
+func TestTokenBucketDurationPeriod(t *testing.T) {
+	slot, err := newTokenBucketSlot("250ms", "interval", 10, 5, 5, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error for duration period: %s", err)
+	}
+
+	if slot.period != 250*time.Millisecond {
+		t.Fatalf("Period should be 250ms, got: %s", slot.period)
+	}
+
+	slot.Read()
+	if slot.Read() != "0" {
+		t.Fatalf("bucket must be empty before the period ends")
+	}
+
+	time.Sleep(260 * time.Millisecond)
+	if slot.Read() != "5" {
+		t.Fatalf("bucket must be refilled after the period")
+	}
+}
+
+func TestTokenBucketInvalidRefill(t *testing.T) {
+	_, err := newTokenBucketSlot("second", "pepe", 10, 5, 5, map[string]string{})
+	if err == nil {
+		t.Fatalf("Expected error when creating token bucket with invalid refill")
+	}
+}
+
+func TestTokenBucketContinuousRateTooHigh(t *testing.T) {
+	_, err := newTokenBucketSlot("1ms", "continuous", 2000000, 2000000, 1, map[string]string{})
+	if err == nil {
+		t.Fatalf("Expected error when more than one token is added every nanosecond")
+	}
+}
+
+func TestTokenBucketContinuousRefill(t *testing.T) {
+	slot, err := newTokenBucketSlot("1s", "continuous", 10, 10, 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	slot.Read()
+	time.Sleep(350 * time.Millisecond)
+
+	tokens, _ := strconv.Atoi(slot.Read())
+	if tokens < 3 || tokens > 4 {
+		t.Fatalf("tokens must be added along the period: %d", tokens)
+	}
+}
+
+func TestTokenBucketTakeAndRefund(t *testing.T) {
+	slot, err := newTokenBucketSlot("hour", "interval", 10, 10, 1, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	taken, err := slot.Take(8, Caller{})
+	if err != nil || taken != 8 {
+		t.Fatalf("tokens must be taken: %d %v", taken, err)
+	}
+
+	taken, err = slot.Take(3, Caller{})
+	if err != ErrNotEnoughTokens || taken != 0 {
+		t.Fatalf("no tokens must be taken when there are not enough: %d %v", taken, err)
+	}
+
+	refunded, _ := slot.Refund(5, Caller{})
+	if refunded != 5 {
+		t.Fatalf("tokens must be refunded: %d", refunded)
+	}
+
+	refunded, _ = slot.Refund(5, Caller{})
+	if refunded != 3 {
+		t.Fatalf("the bucket cannot hold more tokens than its size: %d", refunded)
+	}
+
+	if _, err := slot.Take(11, Caller{}); err == nil {
+		t.Fatalf("cannot take more tokens than the bucket size")
+	}
+}
+
+func TestTokenBucketRefundNotTaken(t *testing.T) {
+	slot, err := newTokenBucketSlot("hour", "interval", 10, 10, 1, map[string]string{})
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	if _, err := slot.Refund(5, Caller{ID: "first"}); err != ErrNotTaken {
+		t.Fatalf("tokens that were not taken cannot be refunded: %v", err)
+	}
+
+	slot.Take(4, Caller{ID: "first"})
+	if _, err := slot.Refund(4, Caller{ID: "second"}); err != ErrNotTaken {
+		t.Fatalf("tokens taken by other clients cannot be refunded: %v", err)
+	}
+
+	refunded, _ := slot.Refund(6, Caller{ID: "first"})
+	if refunded != 4 {
+		t.Fatalf("only the tokens taken can be refunded: %d", refunded)
+	}
+
+	slot.Take(2, Caller{ID: "second", Session: "session"})
+	refunded, _ = slot.Refund(2, Caller{ID: "third", Session: "session"})
+	if refunded != 2 {
+		t.Fatalf("tokens can be refunded by the same session: %d", refunded)
+	}
+}
+
+func TestTokenBucketShadow(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "token_bucket")
+	v.Set("bucket_size", 1)
+	v.Set("period", "hour")
+	v.Set("shadow", true)
+
+	slot, err := GetSlot(v, nil, "002")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if slot.Read() != "1" {
+			t.Fatalf("shadow slots must allow every request")
+		}
+	}
+
+	if _, err := slot.(Taker).Take(1, Caller{}); err != nil {
+		t.Fatalf("shadow slots must allow every request: %s", err)
+	}
+
+	info := slot.(Inspector).Info()
+	if info[len(info)-1] != "shadow_denied=3" {
+		t.Fatalf("denied requests must be counted: %v", info)
+	}
+}
+
+func TestTokenBucketShadowPartial(t *testing.T) {
+	v := viper.New()
+
+	v.Set("kind", "token_bucket")
+	v.Set("bucket_size", 5)
+	v.Set("refresh_rate", 5)
+	v.Set("tokens_per_req", 3)
+	v.Set("period", "hour")
+	v.Set("shadow", true)
+
+	slot, err := GetSlot(v, nil, "002")
+	if err != nil {
+		t.Fatalf("Slot must not return error: %s", err)
+	}
+
+	// The second read would only get the 2 tokens left
+	for i := 0; i < 2; i++ {
+		if slot.Read() != "3" {
+			t.Fatalf("shadow slots must allow the whole request")
+		}
+	}
+
+	info := slot.(Inspector).Info()
+	if info[len(info)-1] != "shadow_denied=1" {
+		t.Fatalf("partial grants must be counted as denied: %v", info)
+	}
+
+	if taken, _ := slot.(Taker).Take(3, Caller{}); taken != 3 {
+		t.Fatalf("shadow slots must allow the whole request: %d", taken)
+	}
+
+	if _, err := slot.(Taker).Refund(3, Caller{}); err != ErrNotTaken {
+		t.Fatalf("tokens allowed by shadow slots cannot be refunded: %v", err)
+	}
+}
+
+func TestTokenBucketSave(t *testing.T) {
+	parent, _ := newTokenBucketSlot("hour", "interval", 10, 10, 1, map[string]string{})
+	slot, _ := newTokenBucketSlot("hour", "interval", 10, 10, 2, map[string]string{})
+	SetParent(slot, parent, "001")
+
+	restore := slot.Save()
+	slot.Read()
+	slot.Take(4, Caller{})
+	restore(false)
+
+	if taken, _ := slot.Take(10, Caller{}); taken != 10 {
+		t.Fatalf("the tokens must be returned to the bucket: %d", taken)
+	}
+
+	if taken, _ := parent.Take(10, Caller{}); taken != 0 {
+		t.Fatalf("the tokens returned to the parent must be taken by the child: %d", taken)
+	}
+}
@@ -0,0 +1,69 @@
+package slots
+
+// versions counts the changes of the value of a slot, so clients can wait
+// for a value newer than the one they have. It is not safe for concurrent
+// use, slots must hold their own lock.
+type versions struct {
+	number    uint64
+	changed   chan struct{}
+	held      bool
+	pending   bool
+	committed string
+}
+
+// bump counts a change and wakes up the clients waiting for it, while the
+// changes are held it only remembers that there was one.
+func (v *versions) bump() {
+	if v.held {
+		v.pending = true
+		return
+	}
+
+	v.number++
+	if v.changed != nil {
+		close(v.changed)
+		v.changed = nil
+	}
+}
+
+// since returns the current version and, when it is not newer than the
+// given one, a channel that is closed on the next change.
+func (v *versions) since(version uint64) (uint64, <-chan struct{}) {
+	if v.number > version {
+		return v.number, nil
+	}
+
+	if v.changed == nil {
+		v.changed = make(chan struct{})
+	}
+	return v.number, v.changed
+}
+
+// hold keeps the changes from being counted until release, so the clients
+// waiting for changes never see the changes of a batch that is rolled back.
+// The given value is the one shown to the clients meanwhile.
+func (v *versions) hold(value string) {
+	v.held = true
+	v.committed = value
+}
+
+// visible returns the value shown to the clients, the value before the
+// changes while they are held.
+func (v *versions) visible(value string) string {
+	if v.held {
+		return v.committed
+	}
+	return value
+}
+
+// release stops holding the changes, they are counted as a single change
+// when they are committed and forgotten otherwise.
+func (v *versions) release(commit bool) {
+	pending := v.pending
+	v.held = false
+	v.pending = false
+	v.committed = ""
+	if commit && pending {
+		v.bump()
+	}
+}
@@ -0,0 +1,79 @@
+package slots
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSinceVersion(t *testing.T) {
+	slot := &memorySlot{}
+
+	version, value, changed := slot.Since(0)
+	if version != 0 || value != "" || changed == nil {
+		t.Fatalf("a new slot must wait for the first write: %d %s", version, value)
+	}
+
+	slot.Write("data", nil)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("the write must wake up the waiting clients")
+	}
+
+	version, value, changed = slot.Since(0)
+	if version != 1 || value != "data" || changed != nil {
+		t.Fatalf("newer versions must be returned without waiting: %d %s", version, value)
+	}
+
+	slot.Reset()
+	version, value, _ = slot.Since(1)
+	if version != 2 || value != "" {
+		t.Fatalf("reset must change the version: %d %s", version, value)
+	}
+}
+
+func TestSinceVersionExpired(t *testing.T) {
+	slot := newMemorySlot(nil, 0, false, nil, "000")
+
+	slot.WriteWithTTL("data", 50*time.Millisecond, nil)
+	version, value, changed := slot.Since(1)
+	if version != 1 || value != "data" || changed == nil {
+		t.Fatalf("the client must wait for the next version: %d %s", version, value)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("the expiration must wake up the waiting clients")
+	}
+
+	version, value, _ = slot.Since(1)
+	if version != 2 || value != "" {
+		t.Fatalf("the expiration must change the version: %d %s", version, value)
+	}
+}
+
+func TestSinceVersionCounters(t *testing.T) {
+	counter := &atomicSlot{}
+	counter.Read()
+	version, value, _ := counter.Since(0)
+	if version != 1 || value != "1" {
+		t.Fatalf("reading the counter must change the version: %d %s", version, value)
+	}
+
+	sequence, err := newSequenceSlot(10, 5, 100, "fail", 0, nil, "000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	version, value, changed := sequence.Since(0)
+	if version != 0 || value != "" || changed == nil {
+		t.Fatalf("a new sequence must wait for the first value: %d %s", version, value)
+	}
+
+	sequence.Next()
+	version, value, _ = sequence.Since(0)
+	if version != 1 || value != "10" {
+		t.Fatalf("handing out a value must change the version: %d %s", version, value)
+	}
+}
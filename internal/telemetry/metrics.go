@@ -52,6 +52,10 @@ type collector struct {
 
 	// latencyCount is the number of latency samples since the last snapshot.
 	latencyCount atomic.Uint64
+
+	// shadowDenied counts, per slot, the requests that limiters in shadow mode
+	// would have denied since the last snapshot.
+	shadowDenied [1000]atomic.Uint64
 }
 
 // global is the package-level singleton collector.
@@ -71,6 +75,11 @@ type Snapshot struct {
 	// AvgLatencyMs is the mean request duration in milliseconds over the last interval.
 	// Zero means no requests were recorded in the interval.
 	AvgLatencyMs float64
+
+	// ShadowDenied is the number of requests that limiters in shadow mode would
+	// have denied over the last interval, by slot. Slots without denied
+	// requests are not included.
+	ShadowDenied map[int]uint64
 }
 
 // Enable activates metric collection. Must be called before starting the
@@ -113,6 +122,16 @@ func RecordRequest(d time.Duration) {
 	global.latencyCount.Add(1)
 }
 
+// RecordShadowDenied records a request that the limiter in the slot would have
+// denied if it was not in shadow mode.
+// No-op when metrics are disabled or the slot is out of range.
+func RecordShadowDenied(slot int) {
+	if !isEnabled() || slot < 0 || slot >= len(global.shadowDenied) {
+		return
+	}
+	global.shadowDenied[slot].Add(1)
+}
+
 // TakeSnapshot collects a point-in-time reading and atomically resets the
 // interval accumulators (request count, latency). The connected-clients gauge
 // is not reset. Elapsed is the number of seconds since the previous snapshot
@@ -132,10 +151,18 @@ func TakeSnapshot(elapsed float64) Snapshot {
 		avgMs = float64(latNs) / float64(latCount) / 1e6
 	}
 
+	shadowDenied := make(map[int]uint64)
+	for slot := range global.shadowDenied {
+		if denied := global.shadowDenied[slot].Swap(0); denied > 0 {
+			shadowDenied[slot] = denied
+		}
+	}
+
 	return Snapshot{
 		Timestamp:         time.Now(),
 		ConnectedClients:  global.connectedClients.Load(),
 		RequestsPerSecond: rps,
 		AvgLatencyMs:      avgMs,
+		ShadowDenied:      shadowDenied,
 	}
 }
@@ -14,6 +14,9 @@ func resetGlobal() {
 	global.requestCount.Store(0)
 	global.latencyNsSum.Store(0)
 	global.latencyCount.Store(0)
+	for i := range global.shadowDenied {
+		global.shadowDenied[i].Store(0)
+	}
 }
 
 func TestDisabledMetricsAreNoOps(t *testing.T) {
@@ -164,3 +167,24 @@ func TestConcurrentConnectedClients(t *testing.T) {
 		t.Errorf("expected 0 after equal incr/decr, got %d", s.ConnectedClients)
 	}
 }
+
+func TestShadowDenied(t *testing.T) {
+	resetGlobal()
+	Enable()
+
+	RecordShadowDenied(2)
+	RecordShadowDenied(2)
+	RecordShadowDenied(7)
+	RecordShadowDenied(-1)
+	RecordShadowDenied(1000)
+
+	s := TakeSnapshot(1.0)
+	if len(s.ShadowDenied) != 2 || s.ShadowDenied[2] != 2 || s.ShadowDenied[7] != 1 {
+		t.Errorf("unexpected shadow denied requests: %v", s.ShadowDenied)
+	}
+
+	s = TakeSnapshot(1.0)
+	if len(s.ShadowDenied) != 0 {
+		t.Errorf("expected shadow denied requests to be reset, got %v", s.ShadowDenied)
+	}
+}
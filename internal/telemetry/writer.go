@@ -140,6 +140,19 @@ func formatSnapshot(s Snapshot) string {
 	sb.WriteString("# TYPE ghoti_request_duration_milliseconds gauge\n")
 	fmt.Fprintf(&sb, "ghoti_request_duration_milliseconds %.3f %d\n", s.AvgLatencyMs, tsMs)
 
+	if len(s.ShadowDenied) > 0 {
+		sb.WriteString("# HELP ghoti_shadow_denied_requests Requests that limiters in shadow mode would have denied over the last interval\n")
+		sb.WriteString("# TYPE ghoti_shadow_denied_requests gauge\n")
+		slotIDs := make([]int, 0, len(s.ShadowDenied))
+		for slot := range s.ShadowDenied {
+			slotIDs = append(slotIDs, slot)
+		}
+		sort.Ints(slotIDs)
+		for _, slot := range slotIDs {
+			fmt.Fprintf(&sb, "ghoti_shadow_denied_requests{slot=\"%03d\"} %d %d\n", slot, s.ShadowDenied[slot], tsMs)
+		}
+	}
+
 	// Blank line between snapshots for readability.
 	sb.WriteString("\n")
 
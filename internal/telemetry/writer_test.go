@@ -8,6 +8,24 @@ import (
 	"time"
 )
 
+func TestFormatSnapshotShadowDenied(t *testing.T) {
+	s := Snapshot{
+		Timestamp:    time.Date(2024, 2, 21, 12, 0, 0, 0, time.UTC),
+		ShadowDenied: map[int]uint64{7: 3, 2: 5},
+	}
+	out := formatSnapshot(s)
+
+	first := strings.Index(out, `ghoti_shadow_denied_requests{slot="002"} 5`)
+	second := strings.Index(out, `ghoti_shadow_denied_requests{slot="007"} 3`)
+	if first < 0 || second < first {
+		t.Errorf("shadow denied requests must be sorted by slot\nfull output:\n%s", out)
+	}
+
+	if strings.Contains(formatSnapshot(Snapshot{}), "ghoti_shadow_denied_requests") {
+		t.Errorf("shadow denied requests must be omitted when empty")
+	}
+}
+
 func TestRotationFilenameDaily(t *testing.T) {
 	ts := time.Date(2024, 2, 21, 15, 30, 0, 0, time.UTC)
 	got := rotationFilename("/var/log", "daily", ts)